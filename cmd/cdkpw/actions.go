@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// StackArgs describes what the positional arguments of a cdk action are.
+type StackArgs string
+
+const (
+	StackArgsMany         StackArgs = "stacks"       // any number of stack selectors, e.g. deploy
+	StackArgsOne          StackArgs = "stack"        // a single stack, e.g. import
+	StackArgsEnvironments StackArgs = "environments" // aws://account/region environments, e.g. bootstrap
+	StackArgsNone         StackArgs = "none"         // no stacks, e.g. context
+)
+
+// cdkAction is how cdkpw treats one cdk command.
+type cdkAction struct {
+	Name      string
+	Stacks    StackArgs
+	StackFlag string // flag naming the stack when it is not positional, e.g. migrate --stack-name
+	Profiled  bool   // resolve a profile, true for every command that talks to AWS
+	Verify    bool   // check the stack accounts against the profile before running
+	AppWide   bool   // without stack arguments it works on the app as a whole, so appProfile applies, e.g. synth
+}
+
+// builtinActions are the cdk commands cdkpw knows, the profiled ones are wrapped by default.
+var builtinActions = []cdkAction{
+	{Name: "deploy", Stacks: StackArgsMany, Profiled: true, Verify: true},
+	{Name: "destroy", Stacks: StackArgsMany, Profiled: true, Verify: true},
+	{Name: "diff", Stacks: StackArgsMany, Profiled: true},
+	{Name: "synth", Stacks: StackArgsMany, Profiled: true, AppWide: true},
+	{Name: "list", Stacks: StackArgsMany, Profiled: true, AppWide: true},
+	{Name: "watch", Stacks: StackArgsMany, Profiled: true, Verify: true},
+	{Name: "import", Stacks: StackArgsOne, Profiled: true, Verify: true},
+	{Name: "drift", Stacks: StackArgsMany, Profiled: true},
+	{Name: "rollback", Stacks: StackArgsMany, Profiled: true, Verify: true},
+	{Name: "refactor", Stacks: StackArgsMany, Profiled: true},
+	{Name: "metadata", Stacks: StackArgsOne, Profiled: true},
+	{Name: "migrate", Stacks: StackArgsNone, StackFlag: "--stack-name", Profiled: true},
+	{Name: "bootstrap", Stacks: StackArgsEnvironments, Profiled: true},
+	{Name: "gc", Stacks: StackArgsEnvironments, Profiled: true},
+	{Name: "context", Stacks: StackArgsNone},
+	{Name: "acknowledge", Stacks: StackArgsNone},
+	{Name: "notices", Stacks: StackArgsNone},
+	{Name: "docs", Stacks: StackArgsNone},
+	{Name: "doctor", Stacks: StackArgsNone},
+	{Name: "flags", Stacks: StackArgsNone},
+	{Name: "init", Stacks: StackArgsNone},
+}
+
+// actionAliases are the alternative names cdk accepts for its commands.
+var actionAliases = map[string]string{
+	"ls":         "list",
+	"synthesize": "synth",
+	"ack":        "acknowledge",
+	"doc":        "docs",
+}
+
+var actionEntry = regexp.MustCompile(`^[+-]?[a-z][a-z0-9-]*$`)
+
+// lookupAction returns the table entry for name, an unknown action takes stacks and is not profiled.
+func lookupAction(name string) cdkAction {
+	if alias, ok := actionAliases[name]; ok {
+		name = alias
+	}
+	for _, action := range builtinActions {
+		if action.Name == name {
+			return action
+		}
+	}
+	return cdkAction{Name: name, Stacks: StackArgsMany}
+}
+
+// stackless reports whether the action runs without stacks or environments, where rules cannot match
+// and appProfile names the profile.
+func (a cdkAction) stackless() bool {
+	return a.Stacks == StackArgsNone || a.AppWide
+}
+
+// profiledAction returns how to treat name and whether cdkpw resolves a profile for it.
+// Entries of profiledActions add an action, or with a leading - remove it, later entries win.
+func (c *Config) profiledAction(name string) (cdkAction, bool) {
+	action := lookupAction(name)
+	profiled := action.Profiled
+	for _, entry := range c.ProfiledActions {
+		removed := strings.HasPrefix(entry, "-")
+		if lookupAction(strings.TrimLeft(entry, "+-")).Name == action.Name {
+			profiled = !removed
+		}
+	}
+	return action, profiled
+}
+
+// knowsAction reports whether name is a cdk command cdkpw knows, built in or added by profiledActions.
+func (c *Config) knowsAction(name string) bool {
+	name = lookupAction(name).Name
+	for _, action := range builtinActions {
+		if action.Name == name {
+			return true
+		}
+	}
+	for _, entry := range c.ProfiledActions {
+		if !strings.HasPrefix(entry, "-") && strings.TrimPrefix(entry, "+") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// unknownActionMsg reports an action that is not a cdk command, suggesting the closest one.
+func unknownActionMsg(name string) string {
+	best, bestDistance := "", len(name)/2+1
+	for _, action := range builtinActions {
+		if distance := levenshtein(name, action.Name); distance < bestDistance {
+			best, bestDistance = action.Name, distance
+		}
+	}
+	if best != "" {
+		return fmt.Sprintf("unknown action %q, did you mean %q?", name, best)
+	}
+	return fmt.Sprintf("unknown action %q, expected a cdk command such as deploy or diff", name)
+}
+
+// checkProfiledActions reports the first malformed entry of profiledActions.
+func (c *Config) checkProfiledActions() error {
+	for _, entry := range c.ProfiledActions {
+		if !actionEntry.MatchString(entry) {
+			return settingError{"profiledActions", fmt.Sprintf("invalid action %q, expected a cdk command, prefixed with - to remove it", entry)}
+		}
+	}
+	return nil
+}
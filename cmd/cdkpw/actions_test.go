@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type actionsSuite struct {
+	suite.Suite
+}
+
+func (s *actionsSuite) TestLookupAction() {
+	s.Equal(StackArgsMany, lookupAction("deploy").Stacks)
+	s.Equal("list", lookupAction("ls").Name)
+	s.Equal("synth", lookupAction("synthesize").Name)
+	s.Equal(StackArgsEnvironments, lookupAction("bootstrap").Stacks)
+	s.Equal(cdkAction{Name: "publish", Stacks: StackArgsMany}, lookupAction("publish"))
+}
+
+func (s *actionsSuite) TestProfiledAction() {
+	tests := []struct {
+		name    string
+		actions []string
+		action  string
+		want    bool
+	}{
+		{name: "built-in", action: "deploy", want: true},
+		{name: "alias of a built-in", action: "ls", want: true},
+		{name: "newer command", action: "drift", want: true},
+		{name: "local command", action: "context", want: false},
+		{name: "unknown command", action: "publish", want: false},
+		{name: "added", actions: []string{"context"}, action: "context", want: true},
+		{name: "added with plus", actions: []string{"+publish"}, action: "publish", want: true},
+		{name: "removed", actions: []string{"-list"}, action: "list", want: false},
+		{name: "removed by alias", actions: []string{"-ls"}, action: "list", want: false},
+		{name: "later entries win", actions: []string{"-synth", "synth"}, action: "synthesize", want: true},
+		{name: "others untouched", actions: []string{"-list"}, action: "diff", want: true},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			config := &Config{ProfiledActions: tt.actions}
+			_, profiled := config.profiledAction(tt.action)
+			s.Equal(tt.want, profiled)
+		})
+	}
+}
+
+func (s *actionsSuite) TestInvalidActions() {
+	_, _, err := decodeConfig("cdkpw.yml", []byte("profiledActions:\n  - Deploy\n"))
+	s.Require().Error(err)
+	s.Equal(`cdkpw.yml:2:3: invalid action "Deploy", expected a cdk command, prefixed with - to remove it`, err.Error())
+}
+
+func (s *actionsSuite) TestStackTargets() {
+	s.Run("no stack arguments", func() {
+		cmd := parseArgs([]string{"context", "--reset", "3", "extra"})
+		cmd.useAction(lookupAction(cmd.Action))
+		s.Require().NoError(cmd.expandStacks("cdk"))
+		s.Equal([]stackTarget{{Action: "context"}}, cmd.stackTargets())
+	})
+
+	s.Run("stack from a flag", func() {
+		cmd := parseArgs([]string{"migrate", "--stack-name", "ProdApi", "--from-path", "template.json"})
+		cmd.useAction(lookupAction(cmd.Action))
+		s.Require().NoError(cmd.expandStacks("cdk"))
+		s.Equal([]stackTarget{{Name: "ProdApi", Action: "migrate"}}, cmd.stackTargets())
+	})
+
+	s.Run("single stack", func() {
+		cmd := parseArgs([]string{"import", "ProdApi", "DevApi"})
+		cmd.useAction(lookupAction(cmd.Action))
+		s.EqualError(cmd.selectStacks("cdk", false), "cdk import takes a single stack, got ProdApi, DevApi")
+
+		cmd = parseArgs([]string{"metadata", "ProdApi"})
+		cmd.useAction(lookupAction(cmd.Action))
+		s.NoError(cmd.selectStacks("cdk", false))
+	})
+
+	s.Run("environments are not wildcards", func() {
+		cmd := parseArgs([]string{"bootstrap", "aws://*/eu-west-1"})
+		cmd.useAction(lookupAction(cmd.Action))
+		s.Require().NoError(cmd.expandStacks("cdk"))
+		s.Equal([]string{"aws://*/eu-west-1"}, cmd.Targets)
+	})
+}
+
+func TestActionsSuite(t *testing.T) {
+	suite.Run(t, new(actionsSuite))
+}
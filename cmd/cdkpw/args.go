@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -9,15 +10,80 @@ import (
 
 var execCommand = exec.Command
 
+// valueFlags are cdk options that consume the next argument, so it is not mistaken for a stack.
+// Boolean options such as --from-stack are left out, and so are short names that differ per command,
+// e.g. -l is --long for cdk list but --language for cdk init.
+var valueFlags = map[string]bool{
+	"--app": true, "-a": true,
+	"--output": true, "-o": true,
+	"--outputs-file": true, "-O": true,
+	"--role-arn": true, "-r": true,
+	"--tags": true, "-t": true,
+	"--plugin": true, "-p": true,
+	"--method": true, "-m": true,
+	"--build-exclude": true, "-E": true,
+	"--bootstrap-bucket-name": true, "-b": true,
+	"--custom-permissions-boundary": true, "-cpb": true,
+	"--require-approval":                  true,
+	"--toolkit-stack-name":                true,
+	"--parameters":                        true,
+	"--notification-arns":                 true,
+	"--change-set-name":                   true,
+	"--concurrency":                       true,
+	"--progress":                          true,
+	"--build":                             true,
+	"--ca-bundle-path":                    true,
+	"--proxy":                             true,
+	"--qualifier":                         true,
+	"--template":                          true,
+	"--context-lines":                     true,
+	"--stack-name":                        true,
+	"--from-path":                         true,
+	"--from-scan":                         true,
+	"--language":                          true,
+	"--filter":                            true,
+	"--account":                           true,
+	"--region":                            true,
+	"--output-path":                       true,
+	"--resource-mapping":                  true,
+	"--record-resource-mapping":           true,
+	"--exclude-file":                      true,
+	"--mapping-file":                      true,
+	"--action":                            true,
+	"--type":                              true,
+	"--rollback-buffer-days":              true,
+	"--created-buffer-days":               true,
+	"--reset":                             true,
+	"--orphan":                            true,
+	"--unstable":                          true,
+	"--trust":                             true,
+	"--trust-for-lookup":                  true,
+	"--untrust":                           true,
+	"--cloudformation-execution-policies": true,
+	"--bootstrap-kms-key-id":              true,
+	"--bootstrap-stack-name":              true,
+}
+
 type CDKCommand struct {
 	Action    string   // diff, deploy, etc.
 	StackName string   // the first non-flag positional arg
+	Stacks    []string // every non-flag positional arg
+	Targets   []string // Stacks with wildcards expanded against the cloud assembly
 	Profile   string   // value from --profile if present
 	RawArgs   []string // full CLI args
 	Context   []string // all `-c` and `--context` switches
 	Flags     []string // any other flags (e.g. --exclusively)
+	Split     bool     // --cdkpw-split, run cdk once per profile group
+
+	Groups   []profileGroup    // set when the stacks are split across profiles
+	action   cdkAction         // how the action takes stacks, see useAction
+	context  map[string]string // context values from the switches and the project, see contextValues
+	assembly []assemblyStack   // stacks from the cloud assembly, loaded on demand
 }
 
+// splitFlag is consumed by cdkpw and never passed on to cdk.
+const splitFlag = "--cdkpw-split"
+
 func (c *CDKCommand) SetProfile(profile string) {
 	if c.Profile != "" {
 		return
@@ -27,6 +93,14 @@ func (c *CDKCommand) SetProfile(profile string) {
 }
 
 func (c *CDKCommand) Execute(cdk string) {
+	if len(c.Groups) > 1 {
+		if err := c.executeGroups(cdk); err != nil {
+			fmt.Println("Error running cdk command:", err)
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+
 	cmd := execCommand(os.ExpandEnv(cdk), c.RawArgs...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -38,14 +112,132 @@ func (c *CDKCommand) Execute(cdk string) {
 	}
 }
 
+// executeGroups runs cdk once per profile group in order and stops at the first failure.
+func (c *CDKCommand) executeGroups(cdk string) error {
+	results := make([]string, len(c.Groups))
+	for i := range results {
+		results[i] = "skipped"
+	}
+
+	var runErr error
+	for i, group := range c.Groups {
+		fmt.Printf("cdkpw: [%d/%d] %s\n", i+1, len(c.Groups), describeGroups([]profileGroup{group}))
+		cmd := execCommand(os.ExpandEnv(cdk), c.groupArgs(group)...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Stdin = os.Stdin
+		if runErr = cmd.Run(); runErr != nil {
+			results[i] = "failed: " + runErr.Error()
+			break
+		}
+		results[i] = "ok"
+	}
+
+	fmt.Println("cdkpw: summary")
+	for i, group := range c.Groups {
+		fmt.Printf("  %s: %s\n", describeGroups([]profileGroup{group}), results[i])
+	}
+	return runErr
+}
+
+// groupArgs builds the cdk arguments for one profile group, keeping the shared flags and context.
+func (c *CDKCommand) groupArgs(group profileGroup) []string {
+	args := append([]string{c.Action}, group.Stacks...)
+	for _, flag := range c.Flags {
+		// the group names its stacks, --all would run every stack with each profile
+		if flag != "--all" {
+			args = append(args, flag)
+		}
+	}
+	args = append(args, c.Context...)
+	if group.Profile != "" {
+		args = append(args, "--profile", group.Profile)
+	}
+	return args
+}
+
+// flagValue returns the value of the first of names found in Flags, as `--name value` or `--name=value`.
+func (c *CDKCommand) flagValue(names ...string) string {
+	for i, flag := range c.Flags {
+		for _, name := range names {
+			if flag == name && i+1 < len(c.Flags) {
+				return c.Flags[i+1]
+			}
+			if value, ok := strings.CutPrefix(flag, name+"="); ok {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+func (c *CDKCommand) hasFlag(name string) bool {
+	for _, flag := range c.Flags {
+		if flag == name {
+			return true
+		}
+	}
+	return false
+}
+
+// profileFor returns the profile cdk will run stack with.
+func (c *CDKCommand) profileFor(stack string) string {
+	for _, group := range c.Groups {
+		for _, name := range group.Stacks {
+			if name == stack {
+				return group.Profile
+			}
+		}
+	}
+	return c.Profile
+}
+
+// profiles lists the distinct profiles cdk will run with.
+func (c *CDKCommand) profiles() []string {
+	if len(c.Groups) == 0 {
+		if c.Profile == "" {
+			return nil
+		}
+		return []string{c.Profile}
+	}
+
+	var profiles []string
+	for _, group := range c.Groups {
+		if group.Profile != "" {
+			profiles = append(profiles, group.Profile)
+		}
+	}
+	return profiles
+}
+
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return exitErr.ExitCode()
+	}
+	return 1
+}
+
+// useAction records how the action takes its arguments, so only real stack selectors are resolved.
+func (c *CDKCommand) useAction(action cdkAction) {
+	c.action = action
+}
+
 func (c *CDKCommand) IsProfiled() bool {
 	return c.Profile != ""
 }
 
 func parseArgs(args []string) *CDKCommand {
-	cmd := CDKCommand{
-		RawArgs: args,
+	cmd := CDKCommand{}
+
+	for _, arg := range args {
+		if arg == splitFlag {
+			cmd.Split = true
+			continue
+		}
+		cmd.RawArgs = append(cmd.RawArgs, arg)
 	}
+	args = cmd.RawArgs
 
 	if len(args) == 0 {
 		return &cmd
@@ -60,7 +252,14 @@ func parseArgs(args []string) *CDKCommand {
 		case arg == "--profile" && i+1 < len(args):
 			cmd.Profile = args[i+1]
 			i++
-		case arg == "-c" || strings.HasPrefix(arg, "-c") || strings.HasPrefix(arg, "--context"):
+		case valueFlags[arg]:
+			// before the context switches, -cpb and --context-lines are not context
+			cmd.Flags = append(cmd.Flags, arg)
+			if i+1 < len(args) {
+				cmd.Flags = append(cmd.Flags, args[i+1])
+				i++
+			}
+		case strings.HasPrefix(arg, "-c") || arg == "--context" || strings.HasPrefix(arg, "--context="):
 			cmd.Context = append(cmd.Context, arg)
 			if (arg == "-c" || arg == "--context") && i+1 < len(args) {
 				cmd.Context = append(cmd.Context, args[i+1])
@@ -68,10 +267,14 @@ func parseArgs(args []string) *CDKCommand {
 			}
 		case strings.HasPrefix(arg, "-"):
 			cmd.Flags = append(cmd.Flags, arg)
-		case cmd.StackName == "":
-			cmd.StackName = arg
+		default:
+			cmd.Stacks = append(cmd.Stacks, arg)
 		}
 	}
 
+	if len(cmd.Stacks) > 0 {
+		cmd.StackName = cmd.Stacks[0]
+	}
+
 	return &cmd
 }
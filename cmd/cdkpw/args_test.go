@@ -27,6 +27,7 @@ func (s *argsSuite) TestParseArgs() {
 			expected: CDKCommand{
 				Action:    "diff",
 				StackName: "my-stack",
+				Stacks:    []string{"my-stack"},
 				Profile:   "my-profile",
 				Context:   []string{"--context", "key=value"},
 				Flags:     []string{"--exclusively"},
@@ -38,6 +39,7 @@ func (s *argsSuite) TestParseArgs() {
 			expected: CDKCommand{
 				Action:    "deploy",
 				StackName: "other-stack",
+				Stacks:    []string{"other-stack"},
 			},
 		},
 		{
@@ -46,6 +48,7 @@ func (s *argsSuite) TestParseArgs() {
 			expected: CDKCommand{
 				Action:    "diff",
 				StackName: "stack-name",
+				Stacks:    []string{"stack-name"},
 				Context:   []string{"-c", "debug=true"},
 			},
 		},
@@ -55,9 +58,70 @@ func (s *argsSuite) TestParseArgs() {
 			expected: CDKCommand{
 				Action:    "destroy",
 				StackName: "secure-stack",
+				Stacks:    []string{"secure-stack"},
 				Flags:     []string{"--exclusively"},
 			},
 		},
+		{
+			name:  "deploy with several stacks",
+			input: []string{"deploy", "DevApi", "--exclusively", "ProdApi"},
+			expected: CDKCommand{
+				Action:    "deploy",
+				StackName: "DevApi",
+				Stacks:    []string{"DevApi", "ProdApi"},
+				Flags:     []string{"--exclusively"},
+			},
+		},
+		{
+			name:  "flag values are not stacks",
+			input: []string{"deploy", "--require-approval", "never", "-o", "out", "ProdApi", "--app=bin/app.js"},
+			expected: CDKCommand{
+				Action:    "deploy",
+				StackName: "ProdApi",
+				Stacks:    []string{"ProdApi"},
+				Flags:     []string{"--require-approval", "never", "-o", "out", "--app=bin/app.js"},
+			},
+		},
+		{
+			name:  "flags starting like context switches",
+			input: []string{"diff", "ProdApi", "--context-lines", "5", "--context=stage=prod", "-cpb", "Boundary"},
+			expected: CDKCommand{
+				Action:    "diff",
+				StackName: "ProdApi",
+				Stacks:    []string{"ProdApi"},
+				Context:   []string{"--context=stage=prod"},
+				Flags:     []string{"--context-lines", "5", "-cpb", "Boundary"},
+			},
+		},
+		{
+			name:  "boolean flags keep the next argument",
+			input: []string{"migrate", "--from-stack", "--stack-name", "ProdApi"},
+			expected: CDKCommand{
+				Action: "migrate",
+				Flags:  []string{"--from-stack", "--stack-name", "ProdApi"},
+			},
+		},
+		{
+			name:  "-l is not a value flag",
+			input: []string{"list", "-l", "Prod*", "--build-exclude", "node_modules"},
+			expected: CDKCommand{
+				Action:    "list",
+				StackName: "Prod*",
+				Stacks:    []string{"Prod*"},
+				Flags:     []string{"-l", "--build-exclude", "node_modules"},
+			},
+		},
+		{
+			name:  "split flag is not passed to cdk",
+			input: []string{"deploy", "--cdkpw-split", "DevApi", "ProdApi"},
+			expected: CDKCommand{
+				Action:    "deploy",
+				StackName: "DevApi",
+				Stacks:    []string{"DevApi", "ProdApi"},
+				RawArgs:   []string{"deploy", "DevApi", "ProdApi"},
+				Split:     true,
+			},
+		},
 		{
 			name:  "missing action",
 			input: []string{},
@@ -73,9 +137,14 @@ func (s *argsSuite) TestParseArgs() {
 			actual := parseArgs(tt.input)
 			s.Equal(tt.expected.Action, actual.Action, "Action")
 			s.Equal(tt.expected.StackName, actual.StackName, "StackName")
+			s.Equal(tt.expected.Stacks, actual.Stacks, "Stacks")
 			s.Equal(tt.expected.Profile, actual.Profile, "Profile")
 			s.Equal(tt.expected.Context, actual.Context, "Context")
 			s.Equal(tt.expected.Flags, actual.Flags, "Flags")
+			s.Equal(tt.expected.Split, actual.Split, "Split")
+			if tt.expected.RawArgs != nil {
+				s.Equal(tt.expected.RawArgs, actual.RawArgs, "RawArgs")
+			}
 		})
 	}
 }
@@ -123,6 +192,58 @@ func (s *commandSuite) TestExecute() {
 	s.Equal([]string{"/usr/local/bin/cdk", "deploy", "MyStack"}, mockExecutedArgs)
 }
 
+var mockExecutedCalls [][]string
+
+func mockRecordingExecCommand(fail string) func(string, ...string) *exec.Cmd {
+	return func(command string, args ...string) *exec.Cmd {
+		mockExecutedCalls = append(mockExecutedCalls, append([]string{command}, args...))
+		for _, arg := range args {
+			if arg == fail {
+				return exec.Command("false")
+			}
+		}
+		return exec.Command("true")
+	}
+}
+
+func (s *commandSuite) TestExecuteGroups() {
+	original := execCommand
+	defer func() { execCommand = original }()
+
+	cmd := &CDKCommand{
+		Action:  "deploy",
+		Flags:   []string{"--require-approval", "never"},
+		Context: []string{"-c", "stage=all"},
+		Groups: []profileGroup{
+			{Profile: "dev_admin", Stacks: []string{"DevApi", "DevWorker"}},
+			{Profile: "prod_admin", Stacks: []string{"ProdApi"}},
+			{Stacks: []string{"SharedVpc"}},
+		},
+	}
+
+	s.Run("runs every group in order", func() {
+		mockExecutedCalls = nil
+		execCommand = mockRecordingExecCommand("")
+
+		s.Require().NoError(cmd.executeGroups("cdk"))
+		s.Equal([][]string{
+			{"cdk", "deploy", "DevApi", "DevWorker", "--require-approval", "never", "-c", "stage=all", "--profile", "dev_admin"},
+			{"cdk", "deploy", "ProdApi", "--require-approval", "never", "-c", "stage=all", "--profile", "prod_admin"},
+			{"cdk", "deploy", "SharedVpc", "--require-approval", "never", "-c", "stage=all"},
+		}, mockExecutedCalls)
+	})
+
+	s.Run("stops at the first failure", func() {
+		mockExecutedCalls = nil
+		execCommand = mockRecordingExecCommand("prod_admin")
+
+		err := cmd.executeGroups("cdk")
+		s.Require().Error(err)
+		s.Equal(1, exitCode(err))
+		s.Len(mockExecutedCalls, 2)
+	})
+}
+
 func TestArgsAndCommand(t *testing.T) {
 	suite.Run(t, new(argsSuite))
 	suite.Run(t, new(commandSuite))
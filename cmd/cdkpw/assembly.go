@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultAssemblyDir = "cdk.out"
+	manifestFile       = "manifest.json"
+	stackArtifact      = "aws:cloudformation:stack"
+	nestedAssembly     = "cdk:cloud-assembly"
+)
+
+// assemblyStack is a stack artifact from the synthesized cloud assembly.
+type assemblyStack struct {
+	ID          string // artifact id, e.g. StageApi1234
+	DisplayName string // hierarchical id as cdk selects it, e.g. Stage/Api
+	Environment string // aws://account/region
+}
+
+type cloudManifest struct {
+	Artifacts map[string]struct {
+		Type        string `json:"type"`
+		DisplayName string `json:"displayName"`
+		Environment string `json:"environment"`
+		Properties  struct {
+			DirectoryName string `json:"directoryName"`
+		} `json:"properties"`
+	} `json:"artifacts"`
+}
+
+// readAssembly collects the stacks of the cloud assembly in dir, descending into nested stage assemblies.
+func readAssembly(dir string) ([]assemblyStack, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest cloudManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid cloud assembly manifest in %s: %w", dir, err)
+	}
+
+	var stacks []assemblyStack
+	for id, artifact := range manifest.Artifacts {
+		switch artifact.Type {
+		case stackArtifact:
+			name := artifact.DisplayName
+			if name == "" {
+				name = id
+			}
+			stacks = append(stacks, assemblyStack{ID: id, DisplayName: name, Environment: artifact.Environment})
+		case nestedAssembly:
+			nested, err := readAssembly(filepath.Join(dir, artifact.Properties.DirectoryName))
+			if err != nil {
+				return nil, err
+			}
+			stacks = append(stacks, nested...)
+		}
+	}
+
+	sort.Slice(stacks, func(i, j int) bool { return stacks[i].DisplayName < stacks[j].DisplayName })
+	return stacks, nil
+}
+
+// listStacks reads the stacks from the cloud assembly, or asks `cdk list` when nothing has been synthesized yet.
+func (c *CDKCommand) listStacks(cdk string) ([]assemblyStack, error) {
+	if c.assembly != nil {
+		return c.assembly, nil
+	}
+
+	stacks, err := readAssembly(c.assemblyDir())
+	if errors.Is(err, fs.ErrNotExist) {
+		stacks, err = c.cdkList(cdk)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.assembly = stacks
+	return stacks, nil
+}
+
+// cdkList runs `cdk list --long`, which synthesizes the app and reports each stack with its environment.
+func (c *CDKCommand) cdkList(cdk string) ([]assemblyStack, error) {
+	args := append([]string{"list", "--long"}, c.Context...)
+	if app := c.flagValue("--app", "-a"); app != "" {
+		args = append(args, "--app", app)
+	}
+	if profiles := c.profiles(); len(profiles) > 0 {
+		// context lookups while synthesizing need the account the command runs against
+		args = append(args, "--profile", profiles[0])
+	}
+	var out bytes.Buffer
+	cmd := execCommand(os.ExpandEnv(cdk), args...)
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("could not list stacks with cdk list: %w", err)
+	}
+
+	var listed []struct {
+		ID          string `yaml:"id"`
+		Name        string `yaml:"name"`
+		Environment struct {
+			Name string `yaml:"name"`
+		} `yaml:"environment"`
+	}
+	if err := yaml.Unmarshal(out.Bytes(), &listed); err != nil {
+		return nil, fmt.Errorf("unexpected cdk list output: %w", err)
+	}
+
+	stacks := make([]assemblyStack, 0, len(listed))
+	for _, stack := range listed {
+		stacks = append(stacks, assemblyStack{ID: stack.ID, DisplayName: stack.ID, Environment: stack.Environment.Name})
+	}
+	return stacks, nil
+}
+
+// assemblyDir is the cloud assembly directory from --output, cdk.json or the cdk default.
+func (c *CDKCommand) assemblyDir() string {
+	if dir := c.flagValue("--output", "-o"); dir != "" {
+		return dir
+	}
+
+	var cdkJSON struct {
+		Output string `json:"output"`
+	}
+	if data, err := os.ReadFile("cdk.json"); err == nil && json.Unmarshal(data, &cdkJSON) == nil && cdkJSON.Output != "" {
+		return cdkJSON.Output
+	}
+	return defaultAssemblyDir
+}
+
+// selectStacks expands wildcards and, when withEnvironment is set, loads the stack environments for resolution.
+func (c *CDKCommand) selectStacks(cdk string, withEnvironment bool) error {
+	if err := c.expandStacks(cdk); err != nil {
+		return err
+	}
+	if c.action.Stacks == StackArgsOne && len(c.Stacks) > 0 && len(c.Targets) > 1 {
+		return fmt.Errorf("cdk %s takes a single stack, got %s", c.Action, strings.Join(c.Targets, ", "))
+	}
+	// environments carry their own account and region, and stackless actions have no stacks to list
+	if withEnvironment && c.action.Stacks != StackArgsEnvironments && c.action.Stacks != StackArgsNone {
+		if _, err := c.listStacks(cdk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stackTargets lists the selected stacks with the account and region recorded in the cloud assembly.
+func (c *CDKCommand) stackTargets() []stackTarget {
+	names := c.Stacks
+	if c.Targets != nil {
+		names = c.Targets
+	}
+	if c.action.Stacks == StackArgsNone {
+		names = []string{""}
+		if c.action.StackFlag != "" {
+			names[0] = c.flagValue(c.action.StackFlag)
+		}
+	}
+	if c.Targets == nil && len(names) == 0 {
+		names = []string{c.StackName}
+	}
+
+	targets := make([]stackTarget, len(names))
+	for i, name := range names {
+		targets[i] = stackTarget{Name: name, Action: c.Action, Context: c.contextValues()}
+		if c.action.Stacks == StackArgsEnvironments {
+			targets[i].Account, targets[i].Region = parseEnvironment(name)
+			continue
+		}
+		for _, stack := range c.assembly {
+			if stack.DisplayName == name || stack.ID == name {
+				targets[i].Account, targets[i].Region = parseEnvironment(stack.Environment)
+				break
+			}
+		}
+	}
+	return targets
+}
+
+// parseEnvironment splits aws://account/region, environment-agnostic placeholders and the
+// wildcards of cdk bootstrap come back empty.
+func parseEnvironment(env string) (string, string) {
+	rest, ok := strings.CutPrefix(env, "aws://")
+	if !ok {
+		return "", ""
+	}
+	account, region, _ := strings.Cut(rest, "/")
+	if strings.HasPrefix(account, "unknown-") || account == "*" {
+		account = ""
+	}
+	if strings.HasPrefix(region, "unknown-") || region == "*" {
+		region = ""
+	}
+	return account, region
+}
+
+// expandStacks replaces wildcard selectors and --all with the stacks they select in the cloud assembly.
+// A command without stack arguments selects every stack or, for bootstrap and gc, every environment.
+func (c *CDKCommand) expandStacks(cdk string) error {
+	c.Targets = c.Stacks
+	switch c.action.Stacks {
+	case StackArgsNone:
+		c.Targets = nil
+		return nil
+	case StackArgsEnvironments:
+		// aws://*/region is not a stack wildcard
+		for _, env := range c.Stacks {
+			if !strings.HasPrefix(env, "aws://") {
+				return fmt.Errorf("cdk %s takes aws://<account>/<region> environments, got %q", c.Action, env)
+			}
+		}
+		if len(c.Stacks) > 0 {
+			return nil
+		}
+		// without environments cdk uses those of the stacks in the app
+		stacks, err := c.listStacks(cdk)
+		if err != nil {
+			return err
+		}
+		c.Targets = []string{}
+		for _, stack := range stacks {
+			if stack.Environment != "" && !slices.Contains(c.Targets, stack.Environment) {
+				c.Targets = append(c.Targets, stack.Environment)
+			}
+		}
+		return nil
+	}
+	// --all, or no stack at all, selects every stack unless the command is about the whole app
+	all := c.hasFlag("--all") || len(c.Stacks) == 0 && c.action.Name != "" && !c.action.AppWide
+	if !all && !hasGlob(c.Stacks) {
+		return nil
+	}
+
+	stacks, err := c.listStacks(cdk)
+	if err != nil {
+		return err
+	}
+
+	if all {
+		// cdk ignores stack arguments next to --all
+		c.Targets = make([]string, len(stacks))
+		for i, stack := range stacks {
+			c.Targets[i] = stack.DisplayName
+		}
+		return nil
+	}
+
+	c.Targets = nil
+	seen := map[string]bool{}
+	for _, selector := range c.Stacks {
+		if !strings.ContainsAny(selector, "*?") {
+			if !seen[selector] {
+				seen[selector] = true
+				c.Targets = append(c.Targets, selector)
+			}
+			continue
+		}
+
+		re := regexp.MustCompile(globToRegexp(selector))
+		matched := false
+		for _, stack := range stacks {
+			if !re.MatchString(stack.DisplayName) {
+				continue
+			}
+			matched = true
+			if !seen[stack.DisplayName] {
+				seen[stack.DisplayName] = true
+				c.Targets = append(c.Targets, stack.DisplayName)
+			}
+		}
+		if !matched {
+			return fmt.Errorf("no stacks match %q", selector)
+		}
+	}
+	return nil
+}
+
+func hasGlob(selectors []string) bool {
+	for _, selector := range selectors {
+		if strings.ContainsAny(selector, "*?") {
+			return true
+		}
+	}
+	return false
+}
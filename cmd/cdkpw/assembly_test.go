@@ -0,0 +1,236 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type assemblySuite struct {
+	suite.Suite
+	dir string
+}
+
+const testManifest = `{
+  "version": "36.0.0",
+  "artifacts": {
+    "ProdApi": {
+      "type": "aws:cloudformation:stack",
+      "environment": "aws://111111111111/eu-west-1",
+      "displayName": "ProdApi"
+    },
+    "ProdWorker": {
+      "type": "aws:cloudformation:stack",
+      "environment": "aws://111111111111/eu-west-1"
+    },
+    "DevApi": {
+      "type": "aws:cloudformation:stack",
+      "environment": "aws://222222222222/eu-west-1",
+      "displayName": "DevApi"
+    },
+    "assembly-Staging": {
+      "type": "cdk:cloud-assembly",
+      "properties": {"directoryName": "assembly-Staging", "displayName": "Staging"}
+    },
+    "Tree": {"type": "cdk:tree", "properties": {"file": "tree.json"}}
+  }
+}`
+
+const testNestedManifest = `{
+  "version": "36.0.0",
+  "artifacts": {
+    "StagingApiA1B2C3": {
+      "type": "aws:cloudformation:stack",
+      "environment": "aws://333333333333/eu-west-1",
+      "displayName": "Staging/Api"
+    }
+  }
+}`
+
+const testCdkListLong = `- id: ProdApi
+  name: ProdApi
+  environment:
+    account: "111111111111"
+    region: eu-west-1
+    name: aws://111111111111/eu-west-1
+- id: Staging/Api
+  name: Staging-Api
+  environment:
+    account: "333333333333"
+    region: eu-west-1
+    name: aws://333333333333/eu-west-1
+- id: DevApi
+  name: DevApi
+  environment:
+    account: unknown-account
+    region: unknown-region
+    name: aws://unknown-account/unknown-region
+`
+
+func (s *assemblySuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.Require().NoError(os.MkdirAll(filepath.Join(s.dir, "assembly-Staging"), 0700))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.dir, manifestFile), []byte(testManifest), 0600))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.dir, "assembly-Staging", manifestFile), []byte(testNestedManifest), 0600))
+}
+
+func (s *assemblySuite) TestReadAssembly() {
+	stacks, err := readAssembly(s.dir)
+	s.Require().NoError(err)
+	s.Equal([]assemblyStack{
+		{ID: "DevApi", DisplayName: "DevApi", Environment: "aws://222222222222/eu-west-1"},
+		{ID: "ProdApi", DisplayName: "ProdApi", Environment: "aws://111111111111/eu-west-1"},
+		{ID: "ProdWorker", DisplayName: "ProdWorker", Environment: "aws://111111111111/eu-west-1"},
+		{ID: "StagingApiA1B2C3", DisplayName: "Staging/Api", Environment: "aws://333333333333/eu-west-1"},
+	}, stacks)
+}
+
+func (s *assemblySuite) TestReadAssembly_Invalid() {
+	s.Require().NoError(os.WriteFile(filepath.Join(s.dir, manifestFile), []byte("{"), 0600))
+	_, err := readAssembly(s.dir)
+	s.Require().Error(err)
+	s.Contains(err.Error(), "invalid cloud assembly manifest")
+}
+
+func (s *assemblySuite) TestExpandStacks() {
+	tests := []struct {
+		name  string
+		stack []string
+		want  []string
+	}{
+		{name: "literal stacks are kept", stack: []string{"DevApi", "Unknown"}, want: []string{"DevApi", "Unknown"}},
+		{name: "prefix wildcard", stack: []string{"Prod*"}, want: []string{"ProdApi", "ProdWorker"}},
+		{name: "stage path", stack: []string{"Staging/*"}, want: []string{"Staging/Api"}},
+		{name: "star stays at top level", stack: []string{"*Api"}, want: []string{"DevApi", "ProdApi"}},
+		{name: "double star", stack: []string{"**Api"}, want: []string{"DevApi", "ProdApi", "Staging/Api"}},
+		{name: "duplicates removed", stack: []string{"ProdApi", "Prod*"}, want: []string{"ProdApi", "ProdWorker"}},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			cmd := parseArgs(append(append([]string{"deploy"}, tt.stack...), "-o", s.dir))
+			s.Require().NoError(cmd.expandStacks("cdk"))
+			s.Equal(tt.want, cmd.Targets)
+		})
+	}
+}
+
+func (s *assemblySuite) TestExpandStacks_NoMatch() {
+	cmd := parseArgs([]string{"deploy", "Qa*", "--output=" + s.dir})
+	err := cmd.expandStacks("cdk")
+	s.Require().Error(err)
+	s.Equal(`no stacks match "Qa*"`, err.Error())
+}
+
+func (s *assemblySuite) TestExpandStacks_CdkListFallback() {
+	original := execCommand
+	defer func() { execCommand = original }()
+
+	var called []string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		called = append([]string{command}, args...)
+		return exec.Command("echo", testCdkListLong)
+	}
+
+	cmd := parseArgs([]string{"diff", "Prod*", "Staging/*", "-c", "stage=prod", "-o", filepath.Join(s.dir, "missing")})
+	s.Require().NoError(cmd.expandStacks("cdk"))
+	s.Equal([]string{"ProdApi", "Staging/Api"}, cmd.Targets)
+	s.Equal([]string{"cdk", "list", "--long", "-c", "stage=prod"}, called)
+	s.Equal([]stackTarget{
+		{Name: "ProdApi", Account: "111111111111", Region: "eu-west-1", Action: "diff", Context: map[string]string{"stage": "prod"}},
+		{Name: "Staging/Api", Account: "333333333333", Region: "eu-west-1", Action: "diff", Context: map[string]string{"stage": "prod"}},
+	}, cmd.stackTargets())
+}
+
+func (s *assemblySuite) TestExpandStacks_ResolvesExpandedNames() {
+	config := &Config{
+		Profiles: []Profile{
+			{Match: "Prod", MatchType: MatchPrefix, Profile: "prod_admin"},
+			{Match: "Staging/", MatchType: MatchPrefix, Profile: "staging_admin"},
+		},
+	}
+
+	cmd := parseArgs([]string{"deploy", "Prod*", "-o", s.dir})
+	s.Require().NoError(cmd.expandStacks("cdk"))
+	s.Require().NoError(config.applyProfiles(cmd))
+	s.Equal("prod_admin", cmd.Profile)
+
+	cmd = parseArgs([]string{"deploy", "**Api", "-o", s.dir})
+	s.Require().NoError(cmd.expandStacks("cdk"))
+	err := config.applyProfiles(cmd)
+	s.Require().Error(err)
+	s.Contains(err.Error(), "DevApi -> (no profile); ProdApi -> prod_admin; Staging/Api -> staging_admin")
+}
+
+func (s *assemblySuite) TestExpandStacks_All() {
+	config := &Config{
+		Profiles: []Profile{
+			{Match: "Prod", MatchType: MatchPrefix, Profile: "prod_admin"},
+			{Match: "Api", MatchType: MatchSuffix, Profile: "api_admin"},
+		},
+	}
+
+	cmd := parseArgs([]string{"deploy", "--all", "-o", s.dir})
+	s.Require().NoError(cmd.expandStacks("cdk"))
+	s.Equal([]string{"DevApi", "ProdApi", "ProdWorker", "Staging/Api"}, cmd.Targets)
+	err := config.applyProfiles(cmd)
+	s.Require().Error(err)
+	s.Contains(err.Error(), "stacks resolve to different profiles: DevApi, Staging/Api -> api_admin; ProdApi, ProdWorker -> prod_admin")
+
+	s.Run("split names the stacks instead of --all", func() {
+		cmd := parseArgs([]string{"deploy", "--all", "-o", s.dir, "--cdkpw-split"})
+		s.Require().NoError(cmd.expandStacks("cdk"))
+		s.Require().NoError(config.applyProfiles(cmd))
+		s.Require().Len(cmd.Groups, 2)
+		s.Equal([]string{"deploy", "ProdApi", "ProdWorker", "-o", s.dir, "--profile", "prod_admin"}, cmd.groupArgs(cmd.Groups[1]))
+	})
+
+	s.Run("one profile keeps --all", func() {
+		config := &Config{Profiles: []Profile{{Match: "**", MatchType: MatchGlob, Profile: "admin"}}}
+		cmd := parseArgs([]string{"deploy", "--all", "-o", s.dir})
+		s.Require().NoError(cmd.expandStacks("cdk"))
+		s.Require().NoError(config.applyProfiles(cmd))
+		s.Equal([]string{"deploy", "--all", "-o", s.dir, "--profile", "admin"}, cmd.RawArgs)
+	})
+}
+
+func (s *assemblySuite) TestStackTargets() {
+	cmd := parseArgs([]string{"deploy", "ProdApi", "StagingApiA1B2C3", "Unknown", "-o", s.dir})
+	s.Require().NoError(cmd.selectStacks("cdk", true))
+	s.Equal([]stackTarget{
+		{Name: "ProdApi", Account: "111111111111", Region: "eu-west-1", Action: "deploy"},
+		{Name: "StagingApiA1B2C3", Account: "333333333333", Region: "eu-west-1", Action: "deploy"},
+		{Name: "Unknown", Action: "deploy"},
+	}, cmd.stackTargets())
+
+	s.Run("no stacks", func() {
+		s.Equal([]stackTarget{{Action: "deploy"}}, parseArgs([]string{"deploy"}).stackTargets())
+	})
+}
+
+func (s *assemblySuite) TestParseEnvironment() {
+	account, region := parseEnvironment("aws://123456789012/eu-west-1")
+	s.Equal("123456789012", account)
+	s.Equal("eu-west-1", region)
+
+	account, region = parseEnvironment("aws://unknown-account/unknown-region")
+	s.Empty(account)
+	s.Empty(region)
+
+	account, _ = parseEnvironment("")
+	s.Empty(account)
+}
+
+func (s *assemblySuite) TestFlagValue() {
+	cmd := parseArgs([]string{"deploy", "--app", "bin/app.js", "--output=out"})
+	s.Equal("bin/app.js", cmd.flagValue("--app", "-a"))
+	s.Equal("out", cmd.flagValue("--output", "-o"))
+	s.Empty(cmd.flagValue("--role-arn"))
+}
+
+func TestAssemblySuite(t *testing.T) {
+	suite.Run(t, new(assemblySuite))
+}
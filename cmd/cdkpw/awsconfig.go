@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// awsConfig holds the sections of the AWS shared config file that cdkpw cares about.
+type awsConfig struct {
+	Path        string
+	Profiles    map[string]map[string]string // [default] and [profile x]
+	SSOSessions map[string]map[string]string // [sso-session x]
+	Credentials map[string]bool              // profiles defined only in the shared credentials file
+	names       []string                     // profile names in file order
+}
+
+// getAWSConfigFile honours AWS_CONFIG_FILE like the AWS CLI does.
+func getAWSConfigFile() (string, error) {
+	if path := os.Getenv("AWS_CONFIG_FILE"); path != "" {
+		return path, nil
+	}
+
+	home, err := getUserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine aws config directory: %w", err)
+	}
+	return filepath.Join(home, ".aws", "config"), nil
+}
+
+// loadAWSConfig reads the AWS shared config file, a missing file is returned as an fs.ErrNotExist error.
+func loadAWSConfig() (*awsConfig, error) {
+	path, err := getAWSConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, err := parseAWSConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read aws config at %s: %w", path, err)
+	}
+	config.Path = path
+	config.Credentials = readCredentialProfiles()
+	return config, nil
+}
+
+// readCredentialProfiles lists the profiles of the shared credentials file, which may hold static keys.
+func readCredentialProfiles() map[string]bool {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := getUserHomeDir()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	names := map[string]bool{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			names[strings.TrimSpace(strings.Trim(line, "[]"))] = true
+		}
+	}
+	return names
+}
+
+func parseAWSConfig(r io.Reader) (*awsConfig, error) {
+	config := &awsConfig{
+		Profiles:    map[string]map[string]string{},
+		SSOSessions: map[string]map[string]string{},
+	}
+
+	var section map[string]string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "["):
+			section = config.section(strings.Trim(line, "[] \t"))
+		case section == nil || raw[0] == ' ' || raw[0] == '\t':
+			// Values outside a known section and nested sub-settings (s3 = ...) are not needed
+			continue
+		default:
+			key, value, ok := strings.Cut(line, "=")
+			if ok {
+				section[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return config, scanner.Err()
+}
+
+// section returns the settings map for a section header, nil for sections cdkpw ignores.
+func (a *awsConfig) section(header string) map[string]string {
+	fields := strings.Fields(header)
+	var target map[string]map[string]string
+	var name string
+	switch {
+	case len(fields) == 1 && fields[0] == "default":
+		target, name = a.Profiles, "default"
+	case len(fields) == 2 && fields[0] == "profile":
+		target, name = a.Profiles, fields[1]
+	case len(fields) == 2 && fields[0] == "sso-session":
+		target, name = a.SSOSessions, fields[1]
+	default:
+		return nil
+	}
+
+	if _, ok := target[name]; !ok {
+		target[name] = map[string]string{}
+		if fields[0] != "sso-session" {
+			a.names = append(a.names, name)
+		}
+	}
+	return target[name]
+}
+
+// profileNames lists the profiles in file order.
+func (a *awsConfig) profileNames() []string {
+	return a.names
+}
+
+// hasProfile reports whether name is defined in the config or credentials file.
+func (a *awsConfig) hasProfile(name string) bool {
+	_, ok := a.Profiles[name]
+	return ok || a.Credentials[name]
+}
+
+// suggest returns the known profiles closest to a misspelled name, best first.
+func (a *awsConfig) suggest(name string) []string {
+	known := append([]string{}, a.names...)
+	for credential := range a.Credentials {
+		if _, ok := a.Profiles[credential]; !ok {
+			known = append(known, credential)
+		}
+	}
+
+	limit := max(2, len(name)/3)
+	var suggestions []string
+	distances := map[string]int{}
+	for _, candidate := range known {
+		distance := levenshtein(strings.ToLower(name), strings.ToLower(candidate))
+		if distance <= limit || strings.Contains(candidate, name) || strings.Contains(name, candidate) {
+			distances[candidate] = distance
+			suggestions = append(suggestions, candidate)
+		}
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool { return distances[suggestions[i]] < distances[suggestions[j]] })
+	if len(suggestions) > 3 {
+		suggestions = suggestions[:3]
+	}
+	return suggestions
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr := make([]int, len(rb)+1)
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev = curr
+	}
+	return prev[len(rb)]
+}
+
+// profilesForAccount lists the profiles whose sso_account_id is account.
+func (a *awsConfig) profilesForAccount(account string) []string {
+	var names []string
+	for _, name := range a.names {
+		if a.Profiles[name]["sso_account_id"] == account {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type awsConfigSuite struct {
+	suite.Suite
+}
+
+const testAWSConfig = `
+[default]
+region = eu-west-1
+
+# production
+[profile prod_admin]
+sso_session = corp
+sso_account_id = 111111111111
+sso_role_name = AdministratorAccess
+
+[profile prod_readonly]
+sso_session = corp
+sso_account_id = 111111111111
+sso_role_name = ReadOnly
+
+[profile dev_admin]
+sso_start_url = https://corp.awsapps.com/start
+sso_region = eu-west-1
+sso_account_id = 222222222222
+sso_role_name = AdministratorAccess
+s3 =
+  max_concurrent_requests = 20
+
+[sso-session corp]
+sso_start_url = https://corp.awsapps.com/start
+sso_region = eu-west-1
+
+[services local]
+s3 =
+  endpoint_url = http://localhost:4566
+`
+
+func writeAWSConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", path)
+	return path
+}
+
+func (s *awsConfigSuite) TestParseAWSConfig() {
+	config, err := parseAWSConfig(strings.NewReader(testAWSConfig))
+	s.Require().NoError(err)
+
+	s.Equal([]string{"default", "prod_admin", "prod_readonly", "dev_admin"}, config.profileNames())
+	s.Equal("eu-west-1", config.Profiles["default"]["region"])
+	s.Equal("corp", config.Profiles["prod_admin"]["sso_session"])
+	s.Equal("222222222222", config.Profiles["dev_admin"]["sso_account_id"])
+	s.Empty(config.Profiles["dev_admin"]["max_concurrent_requests"])
+	s.Equal("https://corp.awsapps.com/start", config.SSOSessions["corp"]["sso_start_url"])
+	s.NotContains(config.Profiles, "local")
+}
+
+func (s *awsConfigSuite) TestProfilesForAccount() {
+	config, err := parseAWSConfig(strings.NewReader(testAWSConfig))
+	s.Require().NoError(err)
+
+	s.Equal([]string{"prod_admin", "prod_readonly"}, config.profilesForAccount("111111111111"))
+	s.Equal([]string{"dev_admin"}, config.profilesForAccount("222222222222"))
+	s.Empty(config.profilesForAccount("333333333333"))
+}
+
+func (s *awsConfigSuite) TestLoadAWSConfig() {
+	path := writeAWSConfig(s.T(), testAWSConfig)
+
+	config, err := loadAWSConfig()
+	s.Require().NoError(err)
+	s.Equal(path, config.Path)
+	s.Len(config.Profiles, 4)
+
+	s.T().Setenv("AWS_CONFIG_FILE", filepath.Join(s.T().TempDir(), "missing"))
+	_, err = loadAWSConfig()
+	s.True(errors.Is(err, fs.ErrNotExist))
+}
+
+func (s *awsConfigSuite) TestGetAWSConfigFile_Home() {
+	original := getUserHomeDir
+	defer func() { getUserHomeDir = original }()
+	getUserHomeDir = func() (string, error) { return "/home/test", nil }
+	s.T().Setenv("AWS_CONFIG_FILE", "")
+
+	path, err := getAWSConfigFile()
+	s.Require().NoError(err)
+	s.Equal("/home/test/.aws/config", path)
+}
+
+func (s *awsConfigSuite) TestSuggest() {
+	config, err := parseAWSConfig(strings.NewReader(testAWSConfig))
+	s.Require().NoError(err)
+	config.Credentials = map[string]bool{"ci_keys": true}
+
+	s.Equal([]string{"prod_admin"}, config.suggest("prod_amdin"))
+	s.Equal([]string{"dev_admin"}, config.suggest("dev"))
+	s.Equal([]string{"ci_keys"}, config.suggest("ci_key"))
+	s.Empty(config.suggest("completely_different"))
+	s.True(config.hasProfile("ci_keys"))
+	s.False(config.hasProfile("corp"))
+}
+
+func (s *awsConfigSuite) TestLevenshtein() {
+	s.Equal(0, levenshtein("prod", "prod"))
+	s.Equal(2, levenshtein("prod_amdin", "prod_admin"))
+	s.Equal(3, levenshtein("", "dev"))
+}
+
+func TestAWSConfigSuite(t *testing.T) {
+	suite.Run(t, new(awsConfigSuite))
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"io"
+)
+
+// subcommand is handled by cdkpw itself instead of being passed on to cdk.
+type subcommand func(args []string, out io.Writer) error
+
+// subcommands are matched on the first argument.
+var subcommands = map[string]subcommand{
+	"which":  runWhich,
+	"config": runConfig,
+	"init":   runInit,
+}
+
+// sharedCommands share their name with a cdk command, cdkpw only handles them when the check accepts the arguments.
+var sharedCommands = map[string]func(args []string) bool{
+	"init": isInitArgs,
+}
+
+// lookupSubcommand returns the cdkpw subcommand for args, if any.
+func lookupSubcommand(args []string) (subcommand, bool) {
+	if len(args) == 0 {
+		return nil, false
+	}
+	run, ok := subcommands[args[0]]
+	if claims, shared := sharedCommands[args[0]]; ok && shared && !claims(args[1:]) {
+		return nil, false
+	}
+	return run, ok
+}
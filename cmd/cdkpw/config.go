@@ -4,9 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
-
-	"gopkg.in/yaml.v3"
 )
 
 const defaultConfigFile = ".cdkpw.yml"
@@ -14,8 +13,21 @@ const defaultConfigFile = ".cdkpw.yml"
 var getUserHomeDir = os.UserHomeDir
 
 type Profile struct {
-	Match   string `yaml:"match"`
-	Profile string `yaml:"profile"`
+	Match         string            `yaml:"match,omitempty" doc:"Pattern compared with the stack name, see matchType"`
+	MatchType     MatchType         `yaml:"matchType,omitempty" doc:"How match is compared with the stack name, defaults to substring"`
+	Profile       string            `yaml:"profile" doc:"AWS profile passed to cdk as --profile"`
+	Name          string            `yaml:"name,omitempty" doc:"Rule name, a higher precedence config replaces the rule with the same name"`
+	Priority      int               `yaml:"priority,omitempty" doc:"Higher wins with resolution: priority, defaults to 0"`
+	Account       string            `yaml:"account,omitempty" doc:"Only match stacks targeting this AWS account ID"`
+	Region        string            `yaml:"region,omitempty" doc:"Only match stacks targeting this AWS region, e.g. eu-west-1"`
+	Context       map[string]string `yaml:"context,omitempty" doc:"Only match when every cdk context value is set as given, e.g. stage: prod, from -c, cdk.json or cdk.context.json"`
+	ExpectAccount string            `yaml:"expectAccount,omitempty" doc:"Account the profile must target, defaults to its sso_account_id"`
+	Actions       map[string]string `yaml:"actions,omitempty" doc:"AWS profile per cdk action, e.g. diff: prod_readonly, actions not listed use profile"`
+
+	re           *regexp.Regexp    // compiled Match for glob and regex rules
+	origin       string            // config source the rule came from
+	line, column int               // position in origin
+	actionAt     map[string][2]int // position of each key of Actions in origin
 }
 
 type Verbose int
@@ -27,38 +39,181 @@ const (
 )
 
 type Config struct {
-	Profiles    []Profile `yaml:"profiles"`
-	CdkLocation string    `yaml:"cdkLocation"`
-	Verbose     Verbose   `yaml:"verbose"`
+	Include         []string       `yaml:"include,omitempty" doc:"Files or globs whose profiles are merged in, relative to this file"`
+	Profiles        []Profile      `yaml:"profiles" doc:"Rules mapping stacks to AWS profiles"`
+	CdkLocation     string         `yaml:"cdkLocation" doc:"cdk executable, environment variables are expanded, defaults to cdk"`
+	Verbose         Verbose        `yaml:"verbose" doc:"0 silent, 1 info, 2 debug"`
+	Resolution      ResolutionMode `yaml:"resolution" doc:"Which rule wins when several match, defaults to longest, prompt asks when the highest priority rules disagree"`
+	Split           bool           `yaml:"split" doc:"Run cdk once per profile when the selected stacks need different profiles"`
+	InferProfiles   bool           `yaml:"inferProfiles" doc:"Use the profile whose sso_account_id is the stack account when no rule matches"`
+	SSOLogin        SSOLoginMode   `yaml:"ssoLogin" doc:"What to do when the SSO session of a profile is missing or expired, defaults to auto"`
+	DefaultProfile  string         `yaml:"defaultProfile,omitempty" doc:"AWS profile for stacks no rule matches"`
+	AppProfile      string         `yaml:"appProfile,omitempty" doc:"AWS profile for commands on the whole app, cdk synth or cdk list without a stack name, usually set per project"`
+	OnNoMatch       OnNoMatchMode  `yaml:"onNoMatch,omitempty" doc:"What to do when no rule matches a stack, defaults to default with a defaultProfile and passthrough without"`
+	ProfiledActions []string       `yaml:"profiledActions,omitempty" doc:"cdk commands to resolve a profile for besides the built-in ones, prefix with - to leave one alone, e.g. -list"`
+
+	aws      *awsConfig // ~/.aws/config, loaded on first use
+	awsErr   error
+	origins  map[string]string // top-level key to the config source that set it
+	sources  []string          // config files merged by loadConfig
+	noPrompt bool              // never ask, e.g. when only explaining the resolution
 }
 
-func (c *Config) findProfile(stackArg string) (string, bool) {
-	// Find all matching profiles
-	var matches []Profile
-	for _, entry := range c.Profiles {
-		if strings.Contains(stackArg, entry.Match) {
-			matches = append(matches, entry)
-		}
+// findTarget returns the profile for the stack, an error means the rules could not agree.
+func (c *Config) findTarget(target stackTarget) (string, bool, error) {
+	res, err := c.resolveTarget(target)
+	if err == nil && res.Prompt {
+		return c.pickProfile(res)
 	}
-	
-	// No matches found
-	if len(matches) == 0 {
-		return "", false
-	}
-	
-	// Sort by match string length (longest first = most specific)
-	// If multiple profiles match, prefer the most specific one
-	bestMatch := matches[0]
-	for _, match := range matches[1:] {
-		if len(match.Match) > len(bestMatch.Match) {
-			bestMatch = match
+	if err != nil || !res.Found() {
+		if err == nil && c.Verbose >= DEBUG {
+			fmt.Printf("cdkpw: No profile for %s: %s\n", stackLabel(target.Name), res.Reason)
 		}
+		return "", false, err
 	}
-	
+
+	profile := res.Winner.profileFor(target.Action)
 	if c.Verbose >= INFO {
-		fmt.Printf("cdkpw: Using profile %s for stack %s\n", bestMatch.Profile, stackArg)
+		fmt.Printf("cdkpw: Using profile %s for %s\n", profile, stackLabel(target.Name))
+	}
+	return profile, true, nil
+}
+
+// needsEnvironment reports whether resolution depends on the stack accounts from the cloud assembly.
+func (c *Config) needsEnvironment() bool {
+	if c.InferProfiles {
+		return true
+	}
+	for _, profile := range c.Profiles {
+		if profile.Account != "" || profile.Region != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// awsProfiles loads the AWS shared config once, nil when it cannot be read.
+func (c *Config) awsProfiles() *awsConfig {
+	if c.aws == nil && c.awsErr == nil {
+		c.aws, c.awsErr = loadAWSConfig()
+		if c.awsErr != nil && c.Verbose >= DEBUG {
+			fmt.Println("cdkpw: Could not load aws config:", c.awsErr)
+		}
+	}
+	return c.aws
+}
+
+// compile prepares every profile rule, reporting the first bad pattern.
+func (c *Config) compile() error {
+	if err := c.compileSettings(); err != nil {
+		return err
+	}
+
+	for i := range c.Profiles {
+		if err := c.Profiles[i].compile(); err != nil {
+			return fmt.Errorf("profile rule %d (match %q): %w", i+1, c.Profiles[i].Match, err)
+		}
+	}
+	return nil
+}
+
+// settingError is an invalid top-level setting.
+type settingError struct {
+	key string
+	msg string
+}
+
+func (e settingError) Error() string {
+	return e.msg
+}
+
+// compileSettings checks the top-level enum settings, each on its own so a single file can be checked.
+func (c *Config) compileSettings() error {
+	switch c.Resolution {
+	case "", ResolveLongest, ResolveFirst, ResolvePriority, ResolveError, ResolvePrompt:
+	default:
+		return settingError{"resolution", fmt.Sprintf("unknown resolution %q, expected first, longest, priority, error or prompt", c.Resolution)}
+	}
+
+	switch c.SSOLogin {
+	case "", SSOLoginAuto, SSOLoginPrint, SSOLoginOff:
+	default:
+		return settingError{"ssoLogin", fmt.Sprintf("unknown ssoLogin %q, expected auto, print or off", c.SSOLogin)}
 	}
-	return bestMatch.Profile, true
+
+	switch c.OnNoMatch {
+	case "", NoMatchPassthrough, NoMatchDefault, NoMatchError, NoMatchPrompt:
+	default:
+		return settingError{"onNoMatch", fmt.Sprintf("unknown onNoMatch %q, expected passthrough, default, error or prompt", c.OnNoMatch)}
+	}
+	return c.checkProfiledActions()
+}
+
+// checkCombined checks settings that depend on each other. Layers may split them, e.g. onNoMatch in the
+// project and defaultProfile in the user config, so only the merged config is checked.
+// An action of a rule may come from profiledActions in another layer too.
+func (c *Config) checkCombined() error {
+	if c.OnNoMatch == NoMatchDefault && c.DefaultProfile == "" {
+		return fmt.Errorf("onNoMatch default needs a defaultProfile")
+	}
+
+	var errs configErrors
+	for _, rule := range c.Profiles {
+		for _, action := range sortedKeys(rule.Actions) {
+			if c.knowsAction(action) {
+				continue
+			}
+			at, ok := rule.actionAt[action]
+			if !ok {
+				at = [2]int{rule.line, rule.column}
+			}
+			errs = append(errs, configError{rule.origin, at[0], at[1], unknownActionMsg(action)})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateProfiles rejects rules whose profile is not defined in the AWS shared config.
+// Without a readable ~/.aws/config, e.g. in CI with environment credentials, nothing is checked.
+func (c *Config) validateProfiles() error {
+	aws := c.awsProfiles()
+	if aws == nil {
+		return nil
+	}
+
+	var problems []string
+	for i, rule := range c.Profiles {
+		for _, profile := range rule.profiles() {
+			if profile == "" || aws.hasProfile(profile) {
+				continue
+			}
+			problem := fmt.Sprintf("profile rule %d (match %q): unknown aws profile %q", i+1, rule.Match, profile)
+			if suggestions := aws.suggest(profile); len(suggestions) > 0 {
+				problem += fmt.Sprintf(", did you mean %s?", strings.Join(suggestions, " or "))
+			}
+			problems = append(problems, problem)
+		}
+	}
+
+	for _, setting := range [][2]string{{"defaultProfile", c.DefaultProfile}, {"appProfile", c.AppProfile}} {
+		key, profile := setting[0], setting[1]
+		if profile == "" || aws.hasProfile(profile) {
+			continue
+		}
+		problem := fmt.Sprintf("%s: unknown aws profile %q", key, profile)
+		if suggestions := aws.suggest(profile); len(suggestions) > 0 {
+			problem += fmt.Sprintf(", did you mean %s?", strings.Join(suggestions, " or "))
+		}
+		problems = append(problems, problem)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s (profiles from %s)", strings.Join(problems, "; "), aws.Path)
+	}
+	return nil
 }
 
 // getConfigPath retrieves the path to the configuration file.
@@ -66,32 +221,55 @@ func getConfigFile() (string, error) {
 	if customConfigPath := os.Getenv("CDKPW_CONFIG"); customConfigPath != "" {
 		return customConfigPath, nil
 	}
+	return getUserConfigFile()
+}
 
+// getUserConfigFile is the per-user config, ~/.cdk/.cdkpw.yml or its JSON or TOML variant.
+func getUserConfigFile() (string, error) {
 	home, err := getUserHomeDir()
 	if err != nil {
 		return "", fmt.Errorf("unable to determine config directory: %w", err)
 	}
-	return filepath.Join(home, ".cdk", defaultConfigFile), nil
+	dir := filepath.Join(home, ".cdk")
+	if path, ok := findConfigIn(dir); ok {
+		return path, nil
+	}
+	return filepath.Join(dir, defaultConfigFile), nil
 }
 
+// loadConfig merges every config layer, see configLayers for the order.
 func loadConfig() (*Config, error) {
-	configPath, err := getConfigFile()
+	layers, err := configLayers()
 	if err != nil {
 		return nil, err
 	}
 
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		return nil, fmt.Errorf("could not read config file at %s: %w", configPath, err)
+	config := Config{origins: map[string]string{}}
+	var loaded []string
+	for _, layer := range layers {
+		config.merge(layer.Config, layer.Keys, layer.Source)
+		if !layer.env {
+			loaded = append(loaded, layer.Source)
+		}
+	}
+	config.sources = loaded
+	source := strings.Join(loaded, ", ")
+
+	if err := config.compile(); err != nil {
+		return nil, fmt.Errorf("invalid config in %s: %w", source, err)
+	}
+
+	if err := config.checkCombined(); err != nil {
+		return nil, fmt.Errorf("invalid config in %s: %w", source, err)
 	}
 
-	config := Config{}
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("invalid YAML in %s: %w", configPath, err)
+	if err := config.validateProfiles(); err != nil {
+		return nil, fmt.Errorf("invalid config in %s: %w", source, err)
 	}
 
 	if config.CdkLocation == "" {
 		config.CdkLocation = "cdk"
+		config.origins["cdkLocation"] = originDefault
 	}
 	return &config, nil
 }
@@ -75,7 +75,8 @@ func (s *configSuite) TestConfigFindProfile_Matching() {
 
 	for _, tt := range tests {
 		s.Run(tt.name, func() {
-			actual, ok := config.findProfile(tt.stackArg)
+			actual, ok, err := config.findTarget(stackTarget{Name: tt.stackArg})
+			s.Require().NoError(err)
 			s.Equal(tt.want, actual)
 			s.Equal(tt.found, ok)
 		})
@@ -129,7 +130,8 @@ func (s *configSuite) TestConfigFindProfile_Specificity() {
 
 	for _, tt := range tests {
 		s.Run(tt.name, func() {
-			actual, ok := config.findProfile(tt.stackArg)
+			actual, ok, err := config.findTarget(stackTarget{Name: tt.stackArg})
+			s.Require().NoError(err)
 			s.Equal(tt.want, actual)
 			s.Equal(tt.found, ok)
 		})
@@ -153,7 +155,7 @@ func (s *configSuite) TestFindProfile_VerbosePrints() {
 
 	// Run the function
 	stackArg := "BackupStack"
-	profile, ok := cfg.findProfile(stackArg)
+	profile, ok, err := cfg.findTarget(stackTarget{Name: stackArg})
 
 	// Stop capturing
 	w.Close()
@@ -162,6 +164,7 @@ func (s *configSuite) TestFindProfile_VerbosePrints() {
 	os.Stdout = old
 
 	// Check results
+	s.Require().NoError(err)
 	if !ok {
 		t.Fatalf("Expected to find a matching profile")
 	}
@@ -193,7 +196,7 @@ func (s *configSuite) TestFindProfile_Silent() {
 
 	// Run the function
 	stackArg := "BackupStack"
-	profile, ok := cfg.findProfile(stackArg)
+	profile, ok, err := cfg.findTarget(stackTarget{Name: stackArg})
 
 	// Stop capturing
 	w.Close()
@@ -202,6 +205,7 @@ func (s *configSuite) TestFindProfile_Silent() {
 	os.Stdout = old
 
 	// Check results
+	s.Require().NoError(err)
 	if !ok {
 		t.Fatalf("Expected to find a matching profile")
 	}
@@ -218,6 +222,7 @@ func (s *configSuite) TestFindProfile_Silent() {
 func (s *configSuite) SetupTest() {
 	s.originalEnv = os.Getenv("CDKPW_CONFIG")
 	s.tempDir = s.T().TempDir()
+	s.T().Setenv("AWS_CONFIG_FILE", filepath.Join(s.tempDir, "aws-config-missing"))
 }
 
 func (s *configSuite) TearDownTest() {
@@ -318,6 +323,49 @@ func (s *configSuite) TestGetConfigFile_ReadError() {
 	s.Contains(err.Error(), "could not read config file at")
 }
 
+func (s *configSuite) TestLoadConfig_UnknownProfile() {
+	yamlContent := `
+profiles:
+  - match: Prod
+    profile: prod_amdin
+  - match: Dev
+    profile: dev_admin
+  - match: Static
+    profile: ci_keys
+  - match: Legacy
+    profile: nothing_like_it
+`
+	configPath := filepath.Join(s.tempDir, "config.yml")
+	s.Require().NoError(os.WriteFile(configPath, []byte(yamlContent), 0600))
+	os.Setenv("CDKPW_CONFIG", configPath)
+	defer os.Unsetenv("CDKPW_CONFIG")
+
+	awsPath := writeAWSConfig(s.T(), testAWSConfig)
+	credentialsPath := filepath.Join(s.tempDir, "credentials")
+	s.Require().NoError(os.WriteFile(credentialsPath, []byte("[ci_keys]\naws_access_key_id = x\n"), 0600))
+	s.T().Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsPath)
+
+	_, err := loadConfig()
+	s.Require().Error(err)
+	s.Contains(err.Error(), `profile rule 1 (match "Prod"): unknown aws profile "prod_amdin", did you mean prod_admin?`)
+	s.Contains(err.Error(), `profile rule 4 (match "Legacy"): unknown aws profile "nothing_like_it" (`)
+	s.Contains(err.Error(), "(profiles from "+awsPath+")")
+	s.NotContains(err.Error(), "dev_admin")
+	s.NotContains(err.Error(), "ci_keys")
+}
+
+func (s *configSuite) TestLoadConfig_KnownProfiles() {
+	configPath := filepath.Join(s.tempDir, "config.yml")
+	s.Require().NoError(os.WriteFile(configPath, []byte("profiles:\n  - match: Prod\n    profile: prod_admin\n"), 0600))
+	os.Setenv("CDKPW_CONFIG", configPath)
+	defer os.Unsetenv("CDKPW_CONFIG")
+	writeAWSConfig(s.T(), testAWSConfig)
+
+	config, err := loadConfig()
+	s.Require().NoError(err)
+	s.NotNil(config.aws, "aws config is kept for later lookups")
+}
+
 func TestConfigSuite(t *testing.T) {
 	suite.Run(t, new(configSuite))
 }
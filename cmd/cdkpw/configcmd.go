@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const configUsage = "usage: cdkpw config init [--yes] [--force] | show [--origin] | validate [file...] | schema | convert [--force] <from> <to>"
+
+// runConfig implements the `cdkpw config` subcommands.
+func runConfig(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(configUsage)
+	}
+
+	switch args[0] {
+	case "init":
+		return runInit(args[1:], out)
+	case "show":
+		return runConfigShow(args[1:], out)
+	case "validate":
+		return runConfigValidate(args[1:], out)
+	case "schema":
+		return runConfigSchema(out)
+	case "convert":
+		return runConfigConvert(args[1:], out)
+	default:
+		return fmt.Errorf("unknown config command %q, %s", args[0], configUsage)
+	}
+}
+
+// runConfigShow prints the merged config, with --origin every value is annotated with its source.
+func runConfigShow(args []string, out io.Writer) error {
+	withOrigin := false
+	for _, arg := range args {
+		if arg != "--origin" {
+			return fmt.Errorf("unknown flag %q, %s", arg, configUsage)
+		}
+		withOrigin = true
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	effective := *config
+	if effective.Resolution == "" {
+		effective.Resolution = ResolveLongest
+	}
+	if effective.SSOLogin == "" {
+		effective.SSOLogin = SSOLoginAuto
+	}
+	effective.OnNoMatch = effective.noMatchMode()
+
+	var node yaml.Node
+	if err := node.Encode(effective); err != nil {
+		return err
+	}
+	if withOrigin {
+		config.annotateOrigins(&node)
+	}
+
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// runConfigValidate strictly checks the given files, or every config source when none are given.
+func runConfigValidate(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		config, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		for _, source := range config.sources {
+			fmt.Fprintf(out, "%s: ok\n", source)
+		}
+		return nil
+	}
+
+	failed := 0
+	for _, path := range args {
+		config, _, err := readConfigTree(path)
+		if err == nil {
+			err = config.compile()
+		}
+		if err == nil {
+			err = config.validateProfiles()
+		}
+		if err != nil {
+			fmt.Fprintln(out, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(out, "%s: ok\n", path)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d config files are invalid", failed, len(args))
+	}
+	return nil
+}
+
+// runConfigConvert rewrites a config file in the format given by the extension of the target, e.g. .toml.
+// Includes are kept as they are, only the keys set in the source are written.
+func runConfigConvert(args []string, out io.Writer) error {
+	force := false
+	var paths []string
+	for _, arg := range args {
+		if arg == "--force" {
+			force = true
+			continue
+		}
+		paths = append(paths, arg)
+	}
+	if len(paths) != 2 {
+		return errors.New(configUsage)
+	}
+	from, to := paths[0], paths[1]
+	if filepath.Base(to) == cdkJSONFile {
+		return fmt.Errorf("cannot convert into %s, paste the converted JSON into its %q block instead", cdkJSONFile, cdkJSONKey)
+	}
+
+	if _, err := os.Stat(to); err == nil && !force {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", to)
+	}
+
+	config, keys, err := readConfigFile(from)
+	if err != nil {
+		return err
+	}
+	data, err := encodeConfig(config, keys, formatOf(to))
+	if err != nil {
+		return fmt.Errorf("could not convert %s: %w", from, err)
+	}
+	if err := os.WriteFile(to, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Converted %s to %s\n", from, to)
+	return nil
+}
+
+// annotateOrigins adds a `# from <source>` comment to every top-level key and profile rule of the encoded config.
+func (c *Config) annotateOrigins(node *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		origin := c.origins[key.Value]
+		if origin == "" {
+			origin = originDefault
+		}
+		key.LineComment = "from " + origin
+
+		if key.Value != "profiles" {
+			continue
+		}
+		for j, item := range value.Content {
+			if j < len(c.Profiles) && c.Profiles[j].origin != "" {
+				item.HeadComment = "from " + c.Profiles[j].origin
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type configCmdSuite struct {
+	suite.Suite
+	path string
+}
+
+func (s *configCmdSuite) SetupTest() {
+	s.path = filepath.Join(s.T().TempDir(), "config.yml")
+	s.Require().NoError(os.WriteFile(s.path, []byte("verbose: 1\nprofiles:\n  - match: Prod\n    matchType: prefix\n    profile: prod_admin\n"), 0600))
+	s.T().Setenv("CDKPW_CONFIG", s.path)
+	s.T().Setenv("AWS_CONFIG_FILE", filepath.Join(s.T().TempDir(), "missing"))
+}
+
+func (s *configCmdSuite) TestShow() {
+	var out bytes.Buffer
+	s.Require().NoError(runConfig([]string{"show"}, &out))
+	s.Equal(`profiles:
+  - match: Prod
+    matchType: prefix
+    profile: prod_admin
+cdkLocation: cdk
+verbose: 1
+resolution: longest
+split: false
+inferProfiles: false
+ssoLogin: auto
+onNoMatch: passthrough
+`, out.String())
+}
+
+func (s *configCmdSuite) TestShowOrigin() {
+	s.T().Setenv("CDKPW_SPLIT", "true")
+
+	var out bytes.Buffer
+	s.Require().NoError(runConfig([]string{"show", "--origin"}, &out))
+	s.Equal(`profiles: # from `+s.path+`
+  # from `+s.path+`
+  - match: Prod
+    matchType: prefix
+    profile: prod_admin
+cdkLocation: cdk # from default
+verbose: 1 # from `+s.path+`
+resolution: longest # from default
+split: true # from env CDKPW_SPLIT
+inferProfiles: false # from default
+ssoLogin: auto # from default
+onNoMatch: passthrough # from default
+`, out.String())
+}
+
+func (s *configCmdSuite) TestUsage() {
+	s.Error(runConfig(nil, &bytes.Buffer{}))
+	s.Error(runConfig([]string{"frobnicate"}, &bytes.Buffer{}))
+	s.Error(runConfig([]string{"show", "--yaml"}, &bytes.Buffer{}))
+}
+
+func TestConfigCmdSuite(t *testing.T) {
+	suite.Run(t, new(configCmdSuite))
+}
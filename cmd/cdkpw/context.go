@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const cdkContextFile = "cdk.context.json"
+
+// contextValues are the cdk context values the command runs with. As in cdk, -c values beat the
+// context of cdk.json, which beats cdk.context.json. Nil when there are none.
+func (c *CDKCommand) contextValues() map[string]string {
+	if c.context != nil {
+		return c.context
+	}
+
+	values := map[string]string{}
+	if path, ok := findProjectCDKJSON(); ok {
+		readContext(filepath.Join(filepath.Dir(path), cdkContextFile), false, values)
+		readContext(path, true, values)
+	}
+	for key, value := range parseContextArgs(c.Context) {
+		values[key] = value
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	c.context = values
+	return values
+}
+
+// parseContextArgs reads key=value from -c and --context switches in any of their spellings.
+func parseContextArgs(args []string) map[string]string {
+	values := map[string]string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-c" || arg == "--context":
+			if i+1 == len(args) {
+				continue
+			}
+			arg = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--context="):
+			arg = strings.TrimPrefix(arg, "--context=")
+		default:
+			arg = strings.TrimPrefix(strings.TrimPrefix(arg, "-c"), "=")
+		}
+		if key, value, ok := strings.Cut(arg, "="); ok && key != "" {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// readContext adds the scalar context values of a cdk.json (under "context") or cdk.context.json to values.
+// A missing or unreadable file adds nothing, cdk reports those itself.
+func readContext(path string, nested bool, values map[string]string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	var file map[string]json.RawMessage
+	if nested {
+		var project struct {
+			Context map[string]json.RawMessage `json:"context"`
+		}
+		if json.Unmarshal(data, &project) != nil {
+			return
+		}
+		file = project.Context
+	} else if json.Unmarshal(data, &file) != nil {
+		return
+	}
+
+	for key, raw := range file {
+		var value any
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if decoder.Decode(&value) != nil {
+			continue
+		}
+		switch value.(type) {
+		case string, bool, json.Number:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type contextSuite struct {
+	suite.Suite
+	project string
+	restore func()
+}
+
+func (s *contextSuite) SetupTest() {
+	s.project = s.T().TempDir()
+	original := getWorkingDir
+	s.restore = func() { getWorkingDir = original }
+	getWorkingDir = func() (string, error) { return s.project, nil }
+}
+
+func (s *contextSuite) TearDownTest() {
+	s.restore()
+}
+
+func (s *contextSuite) write(name, content string) {
+	s.Require().NoError(os.WriteFile(filepath.Join(s.project, name), []byte(content), 0600))
+}
+
+func (s *contextSuite) TestParseContextArgs() {
+	s.Equal(map[string]string{
+		"stage":  "prod",
+		"region": "eu-west-1",
+		"team":   "a=b",
+		"flag":   "",
+	}, parseContextArgs([]string{"-c", "stage=prod", "--context", "region=eu-west-1", "--context=team=a=b", "-cflag=", "-c"}))
+}
+
+func (s *contextSuite) TestContextValues() {
+	s.Run("none", func() {
+		s.Nil(parseArgs([]string{"deploy", "Api"}).contextValues())
+	})
+
+	s.write(cdkJSONFile, `{"app": "npx ts-node bin/app.ts", "context": {"stage": "dev", "replicas": 2, "debug": true, "tags": {"team": "a"}}}`)
+	s.write(cdkContextFile, `{"stage": "cached", "vpc-provider:account=1": {"vpcId": "vpc-1"}, "owner": "platform"}`)
+
+	s.Run("project defaults", func() {
+		s.Equal(map[string]string{"stage": "dev", "replicas": "2", "debug": "true", "owner": "platform"},
+			parseArgs([]string{"deploy", "Api"}).contextValues())
+	})
+
+	s.Run("switches win", func() {
+		s.Equal(map[string]string{"stage": "prod", "replicas": "2", "debug": "true", "owner": "platform"},
+			parseArgs([]string{"deploy", "Api", "-c", "stage=prod"}).contextValues())
+	})
+}
+
+func (s *contextSuite) TestContextRules() {
+	s.write(cdkJSONFile, `{"app": "npx ts-node bin/app.ts", "context": {"stage": "dev"}}`)
+	config := &Config{
+		Profiles: []Profile{
+			{Match: "Api", Profile: "api_admin"},
+			{Context: map[string]string{"stage": "prod"}, Profile: "prod_admin"},
+			{Match: "Api", Context: map[string]string{"stage": "prod", "region": "us"}, Profile: "prod_us"},
+			{Context: map[string]string{"stage": "dev"}, Profile: "dev_admin"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "context from cdk.json", args: []string{"deploy", "Api"}, want: "dev_admin"},
+		{name: "context from a switch", args: []string{"deploy", "Api", "-c", "stage=prod"}, want: "prod_admin"},
+		{name: "more context values win", args: []string{"deploy", "Api", "-c", "stage=prod", "-c", "region=us"}, want: "prod_us"},
+		{name: "name and context must both hold", args: []string{"deploy", "Worker", "-c", "stage=prod", "-c", "region=us"}, want: "prod_admin"},
+		{name: "unmatched context value", args: []string{"deploy", "Api", "-c", "stage=qa"}, want: "api_admin"},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			cmd := parseArgs(tt.args)
+			s.Require().NoError(config.applyProfiles(cmd))
+			s.Equal(tt.want, cmd.Profile)
+		})
+	}
+
+	s.Equal(`context region="us" and context stage="prod" -> prod_us`, Profile{Context: map[string]string{"stage": "prod", "region": "us"}, Profile: "prod_us"}.describe())
+	s.Equal(`substring "Api" and context stage="prod" -> prod_admin`, Profile{Match: "Api", Context: map[string]string{"stage": "prod"}, Profile: "prod_admin"}.describe())
+}
+
+func (s *contextSuite) TestValidate() {
+	_, _, err := decodeConfig("cdkpw.yml", []byte("profiles:\n  - context:\n      stage: prod\n    profile: prod_admin\n  - context:\n      stage: prod\n    profile: other\n"))
+	s.Require().Error(err)
+	s.Equal("cdkpw.yml:5:5: profile rule 2: duplicate of the rule at line 2", err.Error())
+}
+
+func TestContextSuite(t *testing.T) {
+	suite.Run(t, new(contextSuite))
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// configFormat is a config file syntax, picked by file extension.
+type configFormat string
+
+const (
+	formatYAML configFormat = "yaml"
+	formatJSON configFormat = "json"
+	formatTOML configFormat = "toml"
+)
+
+// configFileNames are looked for during discovery, in this order.
+var configFileNames = []string{defaultConfigFile, ".cdkpw.yaml", ".cdkpw.json", ".cdkpw.toml"}
+
+// formatOf picks the format from the extension of path, anything unknown is read as YAML.
+func formatOf(path string) configFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return formatJSON
+	case ".toml":
+		return formatTOML
+	default:
+		return formatYAML
+	}
+}
+
+// parseConfigNode parses data into a YAML document node, whatever the format of path,
+// so every format shares the strict checks and positions of decodeConfig.
+func parseConfigNode(path string, data []byte) (*yaml.Node, error) {
+	if filepath.Base(path) == cdkJSONFile {
+		return parseCDKJSON(path, data)
+	}
+
+	var root yaml.Node
+	switch formatOf(path) {
+	case formatJSON:
+		// JSON is YAML, parsing it as such keeps the line and column of every value
+		var syntax any
+		if err := json.Unmarshal(data, &syntax); err != nil && len(bytes.TrimSpace(data)) > 0 {
+			return nil, fmt.Errorf("invalid JSON in %s: %w", path, err)
+		}
+	case formatTOML:
+		var values map[string]any
+		if _, err := toml.Decode(string(data), &values); err != nil {
+			return nil, fmt.Errorf("invalid TOML in %s: %w", path, err)
+		}
+		if len(values) == 0 {
+			return &root, nil
+		}
+		var doc yaml.Node
+		if err := doc.Encode(values); err != nil {
+			return nil, err
+		}
+		tomlPositions(data, &doc)
+		root.Kind, root.Content = yaml.DocumentNode, []*yaml.Node{&doc}
+		return &root, nil
+	}
+
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid YAML in %s: %w", path, err)
+	}
+	return &root, nil
+}
+
+// parseCDKJSON returns the cdkpw block of a cdk.json, a file without one is reported as fs.ErrNotExist
+// so it is skipped like a missing config file.
+func parseCDKJSON(path string, data []byte) (*yaml.Node, error) {
+	var syntax any
+	if err := json.Unmarshal(data, &syntax); err != nil {
+		return nil, fmt.Errorf("invalid JSON in %s: %w", path, err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid JSON in %s: %w", path, err)
+	}
+
+	if len(root.Content) > 0 && root.Content[0].Kind == yaml.MappingNode {
+		doc := root.Content[0]
+		for i := 0; i+1 < len(doc.Content); i += 2 {
+			if doc.Content[i].Value == cdkJSONKey {
+				root.Content = doc.Content[i+1 : i+2]
+				return &root, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no %q block in %s: %w", cdkJSONKey, path, fs.ErrNotExist)
+}
+
+var (
+	tomlTable = regexp.MustCompile(`^\s*\[{1,2}\s*([A-Za-z0-9_-]+)\s*\]{1,2}`)
+	tomlKey   = regexp.MustCompile(`^(\s*)([A-Za-z0-9_-]+)\s*=`)
+)
+
+// tomlPositions copies the line and column of TOML keys and [[profiles]] tables to the nodes decoded from them,
+// the TOML decoder keeps no positions. Keys it cannot place stay at 0 and are reported without a position.
+func tomlPositions(data []byte, doc *yaml.Node) {
+	type position struct{ line, column int }
+	top := map[string]position{}
+	tables := map[string][]position{}
+	var tableKeys []map[string]position
+	current := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if m := tomlTable.FindStringSubmatchIndex(text); m != nil {
+			current = text[m[2]:m[3]]
+			tables[current] = append(tables[current], position{line, strings.Index(text, "[") + 1})
+			if current == "profiles" {
+				tableKeys = append(tableKeys, map[string]position{})
+			}
+			continue
+		}
+		m := tomlKey.FindStringSubmatchIndex(text)
+		if m == nil {
+			continue
+		}
+		key, pos := text[m[4]:m[5]], position{line, m[4] + 1}
+		switch {
+		case current == "":
+			top[key] = pos
+		case current == "profiles":
+			tableKeys[len(tableKeys)-1][key] = pos
+		}
+	}
+
+	doc.Line, doc.Column = 1, 1
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		key, value := doc.Content[i], doc.Content[i+1]
+		pos, ok := top[key.Value]
+		if !ok && len(tables[key.Value]) > 0 {
+			pos = tables[key.Value][0]
+		}
+		key.Line, key.Column = pos.line, pos.column
+		value.Line, value.Column = pos.line, pos.column
+		if key.Value != "profiles" || ok {
+			continue
+		}
+		for j, item := range value.Content {
+			if j >= len(tableKeys) {
+				break
+			}
+			item.Line, item.Column = tables["profiles"][j].line, tables["profiles"][j].column
+			for k := 0; k+1 < len(item.Content); k += 2 {
+				pos := tableKeys[j][item.Content[k].Value]
+				item.Content[k].Line, item.Content[k].Column = pos.line, pos.column
+				item.Content[k+1].Line, item.Content[k+1].Column = pos.line, pos.column
+			}
+		}
+	}
+}
+
+// encodeConfig renders the keys a file sets in format, keeping the field order of Config.
+func encodeConfig(config Config, keys map[string]bool, format configFormat) ([]byte, error) {
+	var node yaml.Node
+	if err := node.Encode(config); err != nil {
+		return nil, err
+	}
+	var content []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if keys[node.Content[i].Value] {
+			content = append(content, node.Content[i], node.Content[i+1])
+		}
+	}
+	node.Content = content
+
+	switch format {
+	case formatJSON:
+		var b bytes.Buffer
+		if err := writeJSON(&b, &node, ""); err != nil {
+			return nil, err
+		}
+		b.WriteByte('\n')
+		return b.Bytes(), nil
+	case formatTOML:
+		var values map[string]any
+		if err := node.Decode(&values); err != nil {
+			return nil, err
+		}
+		var b bytes.Buffer
+		encoder := toml.NewEncoder(&b)
+		encoder.Indent = ""
+		if err := encoder.Encode(values); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	default:
+		var b bytes.Buffer
+		encoder := yaml.NewEncoder(&b)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&node); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+}
+
+// writeJSON writes an encoded YAML node as indented JSON, unlike a map it keeps the key order.
+func writeJSON(b *bytes.Buffer, node *yaml.Node, indent string) error {
+	inner := indent + "  "
+	switch node.Kind {
+	case yaml.MappingNode:
+		if len(node.Content) == 0 {
+			b.WriteString("{}")
+			return nil
+		}
+		b.WriteString("{\n")
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, _ := json.Marshal(node.Content[i].Value)
+			b.WriteString(inner)
+			b.Write(key)
+			b.WriteString(": ")
+			if err := writeJSON(b, node.Content[i+1], inner); err != nil {
+				return err
+			}
+			if i+2 < len(node.Content) {
+				b.WriteByte(',')
+			}
+			b.WriteByte('\n')
+		}
+		b.WriteString(indent + "}")
+	case yaml.SequenceNode:
+		if len(node.Content) == 0 {
+			b.WriteString("[]")
+			return nil
+		}
+		b.WriteString("[\n")
+		for i, item := range node.Content {
+			b.WriteString(inner)
+			if err := writeJSON(b, item, inner); err != nil {
+				return err
+			}
+			if i+1 < len(node.Content) {
+				b.WriteByte(',')
+			}
+			b.WriteByte('\n')
+		}
+		b.WriteString(indent + "]")
+	case yaml.ScalarNode:
+		switch node.Tag {
+		case "!!int", "!!float":
+			if _, err := strconv.ParseFloat(node.Value, 64); err != nil {
+				return fmt.Errorf("cannot write %q as a JSON number", node.Value)
+			}
+			b.WriteString(node.Value)
+		case "!!bool", "!!null":
+			b.WriteString(node.Value)
+		default:
+			value, _ := json.Marshal(node.Value)
+			b.Write(value)
+		}
+	default:
+		return errors.New("cannot write YAML aliases or documents as JSON")
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type formatSuite struct {
+	suite.Suite
+	dir string
+}
+
+const testFullConfig = `include:
+  - shared/*.yml
+profiles:
+  - match: Prod
+    matchType: prefix
+    profile: prod_admin
+    name: prod
+    priority: 10
+    expectAccount: "111111111111"
+  - profile: dev_admin
+    account: "222222222222"
+cdkLocation: $HOME/bin/cdk
+verbose: 2
+resolution: priority
+split: true
+inferProfiles: true
+ssoLogin: print
+`
+
+func (s *formatSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+}
+
+func (s *formatSuite) write(name, content string) string {
+	path := filepath.Join(s.dir, name)
+	s.Require().NoError(os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func (s *formatSuite) TestRoundTrip() {
+	source := s.write("source.yml", testFullConfig)
+	want, wantKeys, err := readConfigFile(source)
+	s.Require().NoError(err)
+
+	for _, name := range []string{"config.json", "config.toml", "config.yaml"} {
+		s.Run(name, func() {
+			path := filepath.Join(s.dir, name)
+			s.Require().NoError(runConfig([]string{"convert", source, path}, &bytes.Buffer{}))
+
+			got, keys, err := readConfigFile(path)
+			s.Require().NoError(err)
+			s.Equal(wantKeys, keys)
+			s.Equal(stripPositions(want), stripPositions(got))
+
+			back := filepath.Join(s.dir, "back-"+name+".yml")
+			s.Require().NoError(runConfigConvert([]string{path, back}, &bytes.Buffer{}))
+			data, err := os.ReadFile(back)
+			s.Require().NoError(err)
+			s.Equal(testFullConfig, string(data))
+		})
+	}
+}
+
+func (s *formatSuite) TestJSONKeepsFieldOrder() {
+	config := Config{Profiles: []Profile{{Match: "Prod", Profile: "prod_admin", Priority: 1}}, Verbose: INFO}
+	data, err := encodeConfig(config, map[string]bool{"profiles": true, "verbose": true}, formatJSON)
+	s.Require().NoError(err)
+	s.Equal(`{
+  "profiles": [
+    {
+      "match": "Prod",
+      "profile": "prod_admin",
+      "priority": 1
+    }
+  ],
+  "verbose": 1
+}
+`, string(data))
+}
+
+func (s *formatSuite) TestTOMLPositions() {
+	path := s.write("config.toml", `verbose = 5
+
+[[profiles]]
+match = "Prod"
+profile = "prod_admin"
+
+[[profiles]]
+  match = "Dev"
+  profle = "dev_admin"
+`)
+	_, _, err := readConfigFile(path)
+	s.Require().Error(err)
+	s.Equal(path+`:9:3: unknown key "profle", did you mean "profile"?`, err.Error())
+
+	path = s.write("config.toml", `verbose = 5
+
+[[profiles]]
+match = "Prod"
+`)
+	_, _, err = readConfigFile(path)
+	s.Require().Error(err)
+	s.Equal(path+":1:1: verbose must be 0 (silent), 1 (info) or 2 (debug), got 5\n"+
+		path+":3:1: profile rule 1: profile must not be empty", err.Error())
+}
+
+func (s *formatSuite) TestSyntaxErrors() {
+	_, _, err := readConfigFile(s.write("config.json", "verbose: 1\n"))
+	s.Require().Error(err)
+	s.Contains(err.Error(), "invalid JSON in ")
+
+	_, _, err = readConfigFile(s.write("config.toml", "verbose = \n"))
+	s.Require().Error(err)
+	s.Contains(err.Error(), "invalid TOML in ")
+}
+
+func (s *formatSuite) TestEmptyFiles() {
+	for _, name := range []string{"empty.json", "empty.toml", "empty.yml"} {
+		_, keys, err := readConfigFile(s.write(name, ""))
+		s.Require().NoError(err, name)
+		s.Empty(keys, name)
+	}
+}
+
+func (s *formatSuite) TestConvertRefusesOverwrite() {
+	source := s.write("source.yml", testFullConfig)
+	target := s.write("target.json", "{}")
+	err := runConfigConvert([]string{source, target}, &bytes.Buffer{})
+	s.Require().Error(err)
+	s.Contains(err.Error(), "already exists")
+	s.Require().NoError(runConfigConvert([]string{"--force", source, target}, &bytes.Buffer{}))
+}
+
+func (s *formatSuite) TestFormatOf() {
+	s.Equal(formatYAML, formatOf(".cdkpw.yml"))
+	s.Equal(formatYAML, formatOf("/etc/cdkpw.yaml"))
+	s.Equal(formatJSON, formatOf("team.JSON"))
+	s.Equal(formatTOML, formatOf(".cdkpw.toml"))
+}
+
+// stripPositions drops what the decoder records about where rules were read.
+func stripPositions(config Config) Config {
+	for i := range config.Profiles {
+		config.Profiles[i].line, config.Profiles[i].column = 0, 0
+	}
+	return config
+}
+
+func TestFormatSuite(t *testing.T) {
+	suite.Run(t, new(formatSuite))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readConfigTree reads path and merges the profile rules of the files it includes underneath its own,
+// so a shared rule file can be composed with local overrides. Only `profiles` is taken from included files.
+func readConfigTree(path string) (Config, map[string]bool, error) {
+	return readIncluding(path, nil, map[string]bool{})
+}
+
+// readIncluding follows include directives depth first, chain holds the files currently being read
+// to detect cycles and seen skips files already included through another route.
+func readIncluding(path string, chain []string, seen map[string]bool) (Config, map[string]bool, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Config{}, nil, err
+	}
+	for i, including := range chain {
+		if including == abs {
+			return Config{}, nil, fmt.Errorf("include cycle: %s", strings.Join(append(chain[i:], abs), " -> "))
+		}
+	}
+	seen[abs] = true
+	chain = append(chain, abs)
+
+	config, keys, err := readConfigFile(path)
+	if err != nil || len(config.Include) == 0 {
+		return config, keys, err
+	}
+
+	var included Config
+	for _, pattern := range config.Include {
+		files, err := includeFiles(path, pattern)
+		if err != nil {
+			return Config{}, nil, fmt.Errorf("include %q in %s: %w", pattern, path, err)
+		}
+		for _, file := range files {
+			if abs, _ := filepath.Abs(file); seen[abs] && !containsPath(chain, abs) {
+				continue
+			}
+			sub, _, err := readIncluding(file, chain, seen)
+			if err != nil {
+				return Config{}, nil, fmt.Errorf("include %q in %s: %w", pattern, path, err)
+			}
+			included.mergeProfiles(sub.Profiles, file)
+		}
+	}
+
+	// The including file's own rules take precedence over everything it includes
+	included.mergeProfiles(config.Profiles, path)
+	config.Profiles = included.Profiles
+	keys["profiles"] = true
+	return config, keys, nil
+}
+
+// includeFiles resolves an include entry relative to the including file, globs may match nothing
+// but a plain path has to exist.
+func includeFiles(from, pattern string) ([]string, error) {
+	if strings.HasPrefix(pattern, "~/") {
+		home, err := getUserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		pattern = filepath.Join(home, pattern[2:])
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(from), pattern)
+	}
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		if _, err := os.Stat(pattern); err != nil {
+			return nil, err
+		}
+		return []string{pattern}, nil
+	}
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	return files, nil
+}
+
+func containsPath(paths []string, path string) bool {
+	for _, other := range paths {
+		if other == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type includeSuite struct {
+	suite.Suite
+	dir string
+}
+
+func (s *includeSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.Require().NoError(os.MkdirAll(filepath.Join(s.dir, "shared", "teams"), 0700))
+	s.T().Setenv("AWS_CONFIG_FILE", filepath.Join(s.dir, "missing"))
+}
+
+func (s *includeSuite) write(name, content string) string {
+	path := filepath.Join(s.dir, name)
+	s.Require().NoError(os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func (s *includeSuite) profiles(config Config) []string {
+	var profiles []string
+	for _, rule := range config.Profiles {
+		profiles = append(profiles, rule.Profile)
+	}
+	return profiles
+}
+
+func (s *includeSuite) TestInclude() {
+	s.write("shared/org.yml", `
+verbose: 2
+profiles:
+  - name: prod
+    match: Prod
+    profile: org_prod
+  - match: Shared
+    profile: org_shared
+`)
+	s.write("shared/teams/data.yml", "profiles:\n  - match: Data\n    profile: data_admin\n")
+	s.write("shared/teams/web.yml", "profiles:\n  - match: Web\n    profile: web_admin\n")
+	path := s.write("cdkpw.yml", `
+include:
+  - shared/org.yml
+  - shared/teams/*.yml
+profiles:
+  - name: prod
+    match: Prod
+    profile: my_prod
+  - match: Sandbox
+    profile: my_sandbox
+`)
+
+	config, keys, err := readConfigTree(path)
+	s.Require().NoError(err)
+	s.Equal([]string{"my_sandbox", "web_admin", "data_admin", "my_prod", "org_shared"}, s.profiles(config))
+	s.Equal(SILENT, config.Verbose, "only profiles are taken from included files")
+	s.False(keys["verbose"])
+	s.Equal(filepath.Join(s.dir, "shared/org.yml"), config.Profiles[4].origin)
+	s.Equal(path, config.Profiles[3].origin)
+}
+
+func (s *includeSuite) TestNestedAndDiamond() {
+	s.write("shared/base.yml", "profiles:\n  - match: Base\n    profile: base_admin\n")
+	s.write("shared/a.yml", "include: [base.yml]\nprofiles:\n  - match: A\n    profile: a_admin\n")
+	s.write("shared/b.yml", "include: [base.yml]\nprofiles:\n  - match: B\n    profile: b_admin\n")
+	path := s.write("cdkpw.yml", "include: [shared/a.yml, shared/b.yml]\n")
+
+	config, keys, err := readConfigTree(path)
+	s.Require().NoError(err)
+	s.True(keys["profiles"])
+	s.Equal([]string{"b_admin", "a_admin", "base_admin"}, s.profiles(config))
+}
+
+func (s *includeSuite) TestCycle() {
+	s.write("shared/a.yml", "include: [b.yml]\n")
+	s.write("shared/b.yml", "include: [a.yml]\n")
+	path := s.write("cdkpw.yml", "include: [shared/a.yml]\n")
+
+	_, _, err := readConfigTree(path)
+	s.Require().Error(err)
+	s.Contains(err.Error(), `include "shared/a.yml" in `+path)
+	s.Contains(err.Error(), "include cycle: "+filepath.Join(s.dir, "shared/a.yml")+" -> "+filepath.Join(s.dir, "shared/b.yml")+" -> "+filepath.Join(s.dir, "shared/a.yml"))
+}
+
+func (s *includeSuite) TestErrors() {
+	s.Run("missing file", func() {
+		path := s.write("cdkpw.yml", "include: [shared/missing.yml]\n")
+		_, _, err := readConfigTree(path)
+		s.Require().Error(err)
+		s.Contains(err.Error(), `include "shared/missing.yml" in `+path)
+	})
+
+	s.Run("glob without matches", func() {
+		path := s.write("cdkpw.yml", "include: [shared/none-*.yml]\n")
+		_, _, err := readConfigTree(path)
+		s.NoError(err)
+	})
+
+	s.Run("broken included file", func() {
+		s.write("shared/broken.yml", "profiles: [")
+		path := s.write("cdkpw.yml", "include: [shared/broken.yml]\n")
+		_, _, err := readConfigTree(path)
+		s.Require().Error(err)
+		s.Contains(err.Error(), `include "shared/broken.yml" in `+path+": invalid YAML in")
+	})
+}
+
+func (s *includeSuite) TestLoadConfig() {
+	s.write("shared/org.yml", "profiles:\n  - match: Prod\n    profile: org_prod\n")
+	path := s.write("cdkpw.yml", "include: [shared/org.yml]\n")
+	s.T().Setenv("CDKPW_CONFIG", path)
+
+	config, err := loadConfig()
+	s.Require().NoError(err)
+	s.Empty(config.Include)
+
+	profile, ok, err := config.findTarget(stackTarget{Name: "ProdApi"})
+	s.Require().NoError(err)
+	s.True(ok)
+	s.Equal("org_prod", profile)
+}
+
+func TestIncludeSuite(t *testing.T) {
+	suite.Run(t, new(includeSuite))
+}
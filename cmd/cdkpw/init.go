@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+const initUsage = "usage: cdkpw config init [--yes] [--force] [--app <app>] [--output <dir>]"
+
+// stdin is read by the interactive prompts.
+var stdin io.Reader = os.Stdin
+
+// stageNames are the name fragments init looks for, the first entry is used in rules without stacks.
+var stageNames = [][]string{
+	{"Prod", "Production", "Prd"},
+	{"Staging", "Stage", "Stg"},
+	{"Test", "Qa", "Uat"},
+	{"Dev", "Development"},
+	{"Sandbox", "Sbx"},
+}
+
+// initRule is a proposed profile rule with the stacks it was derived from.
+type initRule struct {
+	Profile
+	Stacks       []string
+	Alternatives []string // other aws profiles that look like the same stage
+}
+
+// isInitArgs reports whether args are for `cdkpw init`, which needs a flag cdk does not know such as --yes.
+// Anything else, bare `cdk init` included, is left to `cdk init`.
+func isInitArgs(args []string) bool {
+	claimed := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--yes", "-y", "--force":
+			claimed = true
+		case "--app", "-a", "--output", "-o":
+			i++
+		default:
+			return false
+		}
+	}
+	return claimed
+}
+
+// runInit implements `cdkpw config init`, which proposes rules from the aws profiles and the stacks of the app.
+func runInit(args []string, out io.Writer) error {
+	yes, force := false, false
+	var cdkArgs []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--yes", "-y":
+			yes = true
+		case "--force":
+			force = true
+		case "--app", "-a", "--output", "-o":
+			if i+1 == len(args) {
+				return fmt.Errorf("%s needs a value, %s", args[i], initUsage)
+			}
+			cdkArgs = append(cdkArgs, args[i], args[i+1])
+			i++
+		default:
+			return fmt.Errorf("unknown flag %q, %s", args[i], initUsage)
+		}
+	}
+	if !yes && !stdinIsTerminal() {
+		return fmt.Errorf("stdin is not a terminal, use --yes to accept the proposed rules")
+	}
+
+	path, err := getConfigFile()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", path)
+	}
+
+	aws, err := loadAWSConfig()
+	if err != nil {
+		return fmt.Errorf("could not read aws profiles: %w", err)
+	}
+
+	// an existing config may name the cdk to use, a broken one is what --force is for
+	cdk := "cdk"
+	if config, err := loadConfig(); err == nil {
+		cdk = config.CdkLocation
+	} else if location := os.Getenv(envName("cdkLocation")); location != "" {
+		cdk = location
+	}
+	cmd := parseArgs(append([]string{"list"}, cdkArgs...))
+	stacks, err := cmd.listStacks(cdk)
+	if err != nil {
+		fmt.Fprintf(out, "cdkpw: No stacks found (%v), proposing rules from the aws profiles only\n", err)
+	}
+	names := make([]string, len(stacks))
+	for i, stack := range stacks {
+		names[i] = stack.DisplayName
+	}
+
+	rules := proposeRules(names, aws.profileNames())
+	if !yes {
+		rules, err = confirmRules(rules, aws, inputReader(), out)
+		if err != nil {
+			return err
+		}
+	}
+	if len(rules) == 0 {
+		return fmt.Errorf("no profile rules to write, add them to %s by hand", path)
+	}
+
+	data, err := renderInitConfig(rules)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Wrote %d profile rules to %s\n", len(rules), path)
+	return nil
+}
+
+// proposeRules pairs every stage found in the stack names with the aws profiles named after it.
+// Without stacks a rule is proposed for every stage that has a profile.
+func proposeRules(stacks, profiles []string) []initRule {
+	var rules []initRule
+	for _, stage := range stageNames {
+		candidates := stageProfiles(stage, profiles)
+		if len(candidates) == 0 {
+			continue
+		}
+
+		rule := initRule{Profile: Profile{Match: stage[0], Profile: candidates[0]}, Alternatives: candidates[1:]}
+		if len(stacks) > 0 {
+			word := ""
+			for _, stack := range stacks {
+				if w := stageWord(stack, stage); w != "" {
+					rule.Stacks = append(rule.Stacks, stack)
+					if word == "" {
+						word = w
+					}
+				}
+			}
+			if word == "" {
+				continue
+			}
+			rule.Match, rule.MatchType = matchFor(word, rule.Stacks, stacks)
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// stageProfiles lists the profiles with a name part equal to one of the stage names, in file order.
+func stageProfiles(stage, profiles []string) []string {
+	var matched []string
+	for _, profile := range profiles {
+		parts := strings.FieldsFunc(strings.ToLower(profile), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if containsFold(parts, stage) {
+			matched = append(matched, profile)
+		}
+	}
+	return matched
+}
+
+// stageWord returns the word of stack, as spelled there, that names the stage.
+func stageWord(stack string, stage []string) string {
+	for _, word := range nameWords(stack) {
+		if containsFold(stage, []string{word}) {
+			return word
+		}
+	}
+	return ""
+}
+
+// nameWords splits a stack name into its PascalCase words, DevicesProd-APIStack becomes Devices, Prod, API and Stack.
+func nameWords(name string) []string {
+	var words []string
+	start := -1
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			if start >= 0 {
+				words = append(words, string(runes[start:i]))
+			}
+			start = -1
+		case start < 0:
+			start = i
+		case unicode.IsUpper(r) && (!unicode.IsUpper(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])):
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+func containsFold(list, values []string) bool {
+	for _, a := range list {
+		for _, b := range values {
+			if strings.EqualFold(a, b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchFor picks the simplest rule for word that selects exactly the hit stacks, so Dev does not grab DevicesProd.
+func matchFor(word string, hits, stacks []string) (string, MatchType) {
+	for _, option := range []Profile{{Match: word, MatchType: MatchPrefix}, {Match: word}} {
+		if option.compile() == nil && selects(option, stacks, hits) {
+			return option.Match, option.MatchType
+		}
+	}
+	return `(^|[^A-Za-z]|[a-z])` + regexp.QuoteMeta(word) + `([^a-z]|$)`, MatchRegex
+}
+
+func selects(rule Profile, stacks, hits []string) bool {
+	count := 0
+	for _, stack := range stacks {
+		if rule.matches(stack) {
+			if !containsFold(hits, []string{stack}) {
+				return false
+			}
+			count++
+		}
+	}
+	return count == len(hits)
+}
+
+// confirmRules asks about every rule, an empty answer or y keeps it, n drops it and a profile name replaces the profile.
+func confirmRules(rules []initRule, aws *awsConfig, in *bufio.Reader, out io.Writer) ([]initRule, error) {
+	var confirmed []initRule
+	for _, rule := range rules {
+		for {
+			fmt.Fprintf(out, "%s", rule.describe())
+			if len(rule.Stacks) > 0 {
+				fmt.Fprintf(out, " for %s", strings.Join(rule.Stacks, ", "))
+			}
+			fmt.Fprint(out, "? [Y/n/<profile>] ")
+
+			answer, err := in.ReadString('\n')
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			if errors.Is(err, io.EOF) && answer == "" {
+				fmt.Fprintln(out)
+				return confirmed, nil
+			}
+
+			answer = strings.TrimSpace(answer)
+			switch strings.ToLower(answer) {
+			case "", "y", "yes":
+				confirmed = append(confirmed, rule)
+			case "n", "no":
+			default:
+				if !aws.hasProfile(answer) {
+					fmt.Fprintf(out, "Unknown aws profile %q\n", answer)
+					continue
+				}
+				rule.Profile.Profile = answer
+				confirmed = append(confirmed, rule)
+			}
+			break
+		}
+	}
+	return confirmed, nil
+}
+
+// renderInitConfig writes the rules as YAML with the stacks they cover as comments.
+func renderInitConfig(rules []initRule) ([]byte, error) {
+	profiles := make([]Profile, len(rules))
+	for i, rule := range rules {
+		profiles[i] = rule.Profile
+	}
+
+	var node yaml.Node
+	if err := node.Encode(struct {
+		Profiles []Profile `yaml:"profiles"`
+	}{profiles}); err != nil {
+		return nil, err
+	}
+	for i, item := range node.Content[1].Content {
+		var comments []string
+		if len(rules[i].Stacks) > 0 {
+			comments = append(comments, "stacks: "+strings.Join(rules[i].Stacks, ", "))
+		}
+		if len(rules[i].Alternatives) > 0 {
+			comments = append(comments, "other profiles: "+strings.Join(rules[i].Alternatives, ", "))
+		}
+		item.HeadComment = strings.Join(comments, "\n")
+	}
+	node.HeadComment = strings.Join([]string{
+		"yaml-language-server: $schema=" + schemaID,
+		"Generated by cdkpw config init, see `cdkpw config schema` for every setting.",
+		"verbose: 1",
+		"resolution: longest",
+	}, "\n")
+
+	var b strings.Builder
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return []byte(b.String()), nil
+}
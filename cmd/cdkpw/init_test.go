@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type initSuite struct {
+	suite.Suite
+	home     string
+	assembly string
+	restore  func()
+}
+
+func (s *initSuite) SetupTest() {
+	s.home = s.T().TempDir()
+	s.assembly = s.T().TempDir()
+	s.Require().NoError(os.MkdirAll(filepath.Join(s.assembly, "assembly-Staging"), 0700))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.assembly, manifestFile), []byte(testManifest), 0600))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.assembly, "assembly-Staging", manifestFile), []byte(testNestedManifest), 0600))
+	writeAWSConfig(s.T(), testAWSConfig)
+	s.T().Setenv("CDKPW_CONFIG", "")
+
+	originalHome, originalTerminal, originalStdin := getUserHomeDir, stdinIsTerminal, stdin
+	s.restore = func() { getUserHomeDir, stdinIsTerminal, stdin = originalHome, originalTerminal, originalStdin }
+	getUserHomeDir = func() (string, error) { return s.home, nil }
+	stdinIsTerminal = func() bool { return true }
+}
+
+func (s *initSuite) TearDownTest() {
+	s.restore()
+}
+
+func (s *initSuite) configFile() string {
+	return filepath.Join(s.home, ".cdk", defaultConfigFile)
+}
+
+func (s *initSuite) TestYesWritesLoadableConfig() {
+	var out bytes.Buffer
+	s.Require().NoError(runInit([]string{"--yes", "-o", s.assembly}, &out))
+	s.Contains(out.String(), "Wrote 2 profile rules to "+s.configFile())
+
+	data, err := os.ReadFile(s.configFile())
+	s.Require().NoError(err)
+	s.Contains(string(data), "# yaml-language-server: $schema="+schemaID)
+	s.Contains(string(data), "  # stacks: ProdApi, ProdWorker\n  # other profiles: prod_readonly\n")
+
+	config, err := loadConfig()
+	s.Require().NoError(err)
+	s.Equal([]Profile{
+		{Match: "Prod", MatchType: MatchPrefix, Profile: "prod_admin"},
+		{Match: "Dev", MatchType: MatchPrefix, Profile: "dev_admin"},
+	}, stripRules(config.Profiles))
+}
+
+func (s *initSuite) TestInteractive() {
+	stdin = strings.NewReader("prod_typo\nprod_readonly\nn\n")
+
+	var out bytes.Buffer
+	s.Require().NoError(runInit([]string{"-o", s.assembly}, &out))
+	s.Contains(out.String(), `prefix "Prod" -> prod_admin for ProdApi, ProdWorker? [Y/n/<profile>] Unknown aws profile "prod_typo"`)
+	s.Contains(out.String(), `prefix "Dev" -> dev_admin for DevApi? [Y/n/<profile>] `)
+
+	config, err := loadConfig()
+	s.Require().NoError(err)
+	s.Equal([]Profile{{Match: "Prod", MatchType: MatchPrefix, Profile: "prod_readonly"}}, stripRules(config.Profiles))
+}
+
+func (s *initSuite) TestNothingConfirmed() {
+	stdin = strings.NewReader("n\n")
+	err := runInit([]string{"-o", s.assembly}, &bytes.Buffer{})
+	s.Require().Error(err)
+	s.Contains(err.Error(), "no profile rules to write")
+	s.NoFileExists(s.configFile())
+}
+
+func (s *initSuite) TestNonInteractiveNeedsYes() {
+	stdinIsTerminal = func() bool { return false }
+	err := runInit(nil, &bytes.Buffer{})
+	s.Require().Error(err)
+	s.Contains(err.Error(), "use --yes")
+}
+
+func (s *initSuite) TestExistingConfig() {
+	s.Require().NoError(os.MkdirAll(filepath.Dir(s.configFile()), 0700))
+	s.Require().NoError(os.WriteFile(s.configFile(), []byte("profiles: []\n"), 0600))
+
+	err := runInit([]string{"--yes", "-o", s.assembly}, &bytes.Buffer{})
+	s.Require().Error(err)
+	s.Contains(err.Error(), "already exists, use --force")
+
+	s.Require().NoError(runInit([]string{"--yes", "--force", "-o", s.assembly}, &bytes.Buffer{}))
+}
+
+func (s *initSuite) TestCdkLocationFromConfig() {
+	original := execCommand
+	defer func() { execCommand = original }()
+	var called []string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		called = append([]string{command}, args...)
+		return exec.Command("echo", testCdkListLong)
+	}
+
+	s.Require().NoError(os.MkdirAll(filepath.Dir(s.configFile()), 0700))
+	s.Require().NoError(os.WriteFile(s.configFile(), []byte("cdkLocation: npx cdk\nprofiles: []\n"), 0600))
+	s.Require().NoError(runInit([]string{"--yes", "--force", "-o", filepath.Join(s.assembly, "missing")}, &bytes.Buffer{}))
+	s.Equal([]string{"npx cdk", "list", "--long"}, called)
+
+	s.Run("broken config", func() {
+		s.Require().NoError(os.WriteFile(s.configFile(), []byte("profle: []\n"), 0600))
+		s.T().Setenv("CDKPW_CDK_LOCATION", "/opt/cdk")
+		s.Require().NoError(runInit([]string{"--yes", "--force", "-o", filepath.Join(s.assembly, "missing")}, &bytes.Buffer{}))
+		s.Equal("/opt/cdk", called[0])
+	})
+}
+
+func (s *initSuite) TestProposeRules() {
+	profiles := []string{"default", "prod_admin", "staging-admin", "dev_admin", "sandbox"}
+
+	rules := proposeRules([]string{"DevApi", "DevicesProdStack", "Api-Dev", "Staging/Api"}, profiles)
+	s.Require().Len(rules, 3)
+	s.Equal(Profile{Match: "Prod", Profile: "prod_admin"}, rules[0].Profile)
+	s.Equal([]string{"DevicesProdStack"}, rules[0].Stacks)
+	s.Equal(Profile{Match: "Staging", MatchType: MatchPrefix, Profile: "staging-admin"}, rules[1].Profile)
+	s.Equal(Profile{Match: `(^|[^A-Za-z]|[a-z])Dev([^a-z]|$)`, MatchType: MatchRegex, Profile: "dev_admin"}, rules[2].Profile)
+	s.Equal([]string{"DevApi", "Api-Dev"}, rules[2].Stacks)
+
+	s.Require().NoError(rules[2].compile())
+	s.True(rules[2].matches("Api-Dev"))
+	s.False(rules[2].matches("DevicesProdStack"))
+
+	rules = proposeRules(nil, profiles)
+	s.Len(rules, 4)
+	s.Equal("Sandbox", rules[3].Match)
+}
+
+func (s *initSuite) TestNameWords() {
+	s.Equal([]string{"Devices", "Prod", "Api"}, nameWords("DevicesProd-Api"))
+	s.Equal([]string{"Staging", "API", "Stack2"}, nameWords("Staging/APIStack2"))
+}
+
+func (s *initSuite) TestSharedWithCdkInit() {
+	_, ok := lookupSubcommand([]string{"init"})
+	s.False(ok, "bare cdk init lists the cdk templates")
+	_, ok = lookupSubcommand([]string{"init", "--app", "npx ts-node bin/app.ts"})
+	s.False(ok)
+	_, ok = lookupSubcommand([]string{"init", "--yes", "--app", "npx ts-node bin/app.ts"})
+	s.True(ok)
+	_, ok = lookupSubcommand([]string{"init", "--force"})
+	s.True(ok)
+
+	err := runConfig([]string{"init", "--bogus"}, &bytes.Buffer{})
+	s.EqualError(err, `unknown flag "--bogus", `+initUsage)
+	_, ok = lookupSubcommand([]string{"init", "app", "--language", "typescript"})
+	s.False(ok)
+}
+
+// stripRules drops the load positions so rules compare by their settings.
+func stripRules(rules []Profile) []Profile {
+	stripped := make([]Profile, len(rules))
+	for i, rule := range rules {
+		stripped[i] = Profile{Match: rule.Match, MatchType: rule.MatchType, Profile: rule.Profile}
+	}
+	return stripped
+}
+
+func TestInitSuite(t *testing.T) {
+	suite.Run(t, new(initSuite))
+}
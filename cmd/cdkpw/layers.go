@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	cdkJSONFile   = "cdk.json"
+	cdkJSONKey    = "cdkpw" // block of cdk.json holding project settings
+	originDefault = "default"
+)
+
+var (
+	getWorkingDir    = os.Getwd
+	systemConfigFile = "/etc/cdkpw.yml"
+)
+
+// readConfigFile decodes one config file and reports which top-level keys it sets,
+// so merging can tell an explicit `verbose: 0` from an absent key.
+func readConfigFile(path string) (Config, map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, nil, fmt.Errorf("could not read config file at %s: %w", path, err)
+	}
+	return decodeConfig(path, data)
+}
+
+// merge applies the keys set by a higher precedence source on top of c and records where they came from.
+// Scalars are replaced. A profile rule replaces the existing rule with the same name, other rules are
+// placed ahead of the existing ones so they win ties.
+func (c *Config) merge(src Config, keys map[string]bool, source string) {
+	if c.origins == nil {
+		c.origins = map[string]string{}
+	}
+
+	dst := reflect.ValueOf(c).Elem()
+	from := reflect.ValueOf(src)
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Type().Field(i)
+		name := yamlName(field)
+		if name == "" || name == "include" || !keys[name] {
+			continue
+		}
+		c.origins[name] = source
+		if name == "profiles" {
+			c.mergeProfiles(src.Profiles, source)
+			continue
+		}
+		dst.Field(i).Set(from.Field(i))
+	}
+}
+
+func (c *Config) mergeProfiles(rules []Profile, source string) {
+	var added []Profile
+	for _, rule := range rules {
+		if rule.origin == "" {
+			rule.origin = source
+		}
+		replaced := false
+		for i := range c.Profiles {
+			if rule.Name != "" && c.Profiles[i].Name == rule.Name {
+				c.Profiles[i] = rule
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			added = append(added, rule)
+		}
+	}
+	c.Profiles = append(added, c.Profiles...)
+}
+
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// configLayer is one source of configuration and the top-level keys it sets.
+type configLayer struct {
+	Source string
+	Config Config
+	Keys   map[string]bool
+	env    bool
+}
+
+// configLayers lists the config sources from lowest to highest precedence:
+// system (/etc/cdkpw.yml), user (~/.cdk/.cdkpw.yml), the cdkpw block of the project cdk.json,
+// project (.cdkpw.yml up to cdk.json), CDKPW_CONFIG and finally CDKPW_* environment overrides. Only CDKPW_CONFIG has to exist,
+// but at least one file is required.
+func configLayers() ([]configLayer, error) {
+	userPath, err := getUserConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{systemConfigFile, userPath}
+	if cdkJSON, ok := findProjectCDKJSON(); ok && hasCDKPWBlock(cdkJSON) {
+		paths = append(paths, cdkJSON)
+	}
+	if projectPath, ok := findProjectConfig(); ok {
+		paths = append(paths, projectPath)
+	}
+
+	var layers []configLayer
+	var seen []string
+	var userErr error
+	for _, path := range paths {
+		// Only a missing layer is skipped, a missing file it includes is an error
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			if path == userPath {
+				userErr = fmt.Errorf("could not read config file at %s: %w", path, err)
+			}
+			continue
+		}
+		layer, err := readLayer(path, seen)
+		if err != nil {
+			return nil, err
+		}
+		if layer != nil {
+			layers = append(layers, *layer)
+			seen = append(seen, path)
+		}
+	}
+
+	if customPath := os.Getenv("CDKPW_CONFIG"); customPath != "" {
+		layer, err := readLayer(customPath, seen)
+		if err != nil {
+			return nil, err
+		}
+		if layer != nil {
+			layers = append(layers, *layer)
+		}
+	}
+
+	if len(layers) == 0 {
+		return nil, userErr
+	}
+
+	env, err := envLayers()
+	if err != nil {
+		return nil, err
+	}
+	return append(layers, env...), nil
+}
+
+// readLayer reads path unless it has already been loaded under another name.
+func readLayer(path string, seen []string) (*configLayer, error) {
+	for _, other := range seen {
+		if samePath(path, other) {
+			return nil, nil
+		}
+	}
+
+	config, keys, err := readConfigTree(path)
+	if err != nil {
+		return nil, err
+	}
+	return &configLayer{Source: path, Config: config, Keys: keys}, nil
+}
+
+// envLayers turns CDKPW_<KEY> variables into one layer each, e.g. CDKPW_VERBOSE or CDKPW_CDK_LOCATION.
+// Values are parsed as YAML, lists such as profiles cannot be set this way.
+func envLayers() ([]configLayer, error) {
+	var layers []configLayer
+	fields := reflect.TypeOf(Config{})
+	for i := 0; i < fields.NumField(); i++ {
+		name := yamlName(fields.Field(i))
+		if name == "" || fields.Field(i).Type.Kind() == reflect.Slice {
+			continue
+		}
+
+		variable := envName(name)
+		value, ok := os.LookupEnv(variable)
+		if !ok {
+			continue
+		}
+
+		var config Config
+		target := reflect.ValueOf(&config).Elem().Field(i).Addr().Interface()
+		if err := yaml.Unmarshal([]byte(value), target); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", variable, err)
+		}
+		layers = append(layers, configLayer{Source: "env " + variable, Config: config, Keys: map[string]bool{name: true}, env: true})
+	}
+	return layers, nil
+}
+
+// envName maps a config key to its override variable, cdkLocation becomes CDKPW_CDK_LOCATION.
+func envName(key string) string {
+	var b strings.Builder
+	b.WriteString("CDKPW_")
+	for i, r := range key {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// findProjectRoot walks up from dir to the nearest directory holding cdk.json.
+func findProjectRoot(dir string) (string, bool) {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, cdkJSONFile)); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// findProjectCDKJSON returns the cdk.json of the CDK project around the working directory.
+func findProjectCDKJSON() (string, bool) {
+	dir, err := getWorkingDir()
+	if err != nil {
+		return "", false
+	}
+	root, ok := findProjectRoot(dir)
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(root, cdkJSONFile), true
+}
+
+// hasCDKPWBlock reports whether the cdk.json at path has a cdkpw block. A file that cannot be
+// parsed counts as having one, so reading the layer reports the problem.
+func hasCDKPWBlock(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var file map[string]json.RawMessage
+	if json.Unmarshal(data, &file) != nil {
+		return true
+	}
+	_, ok := file[cdkJSONKey]
+	return ok
+}
+
+// findProjectConfig looks for a config file from the working directory up to the CDK project root.
+func findProjectConfig() (string, bool) {
+	dir, err := getWorkingDir()
+	if err != nil {
+		return "", false
+	}
+	root, ok := findProjectRoot(dir)
+	if !ok {
+		return "", false
+	}
+
+	for {
+		if path, ok := findConfigIn(dir); ok {
+			return path, true
+		}
+		if dir == root {
+			return "", false
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// findConfigIn returns the first of configFileNames that exists in dir.
+func findConfigIn(dir string) (string, bool) {
+	for _, name := range configFileNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type layersSuite struct {
+	suite.Suite
+	home    string
+	project string
+	restore func()
+}
+
+func (s *layersSuite) SetupTest() {
+	s.home = s.T().TempDir()
+	s.project = filepath.Join(s.T().TempDir(), "app")
+	s.Require().NoError(os.MkdirAll(filepath.Join(s.project, "lib", "stacks"), 0700))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.project, cdkJSONFile), []byte(`{"app": "npx ts-node bin/app.ts"}`), 0600))
+
+	originalHome, originalWd := getUserHomeDir, getWorkingDir
+	s.restore = func() { getUserHomeDir, getWorkingDir = originalHome, originalWd }
+	getUserHomeDir = func() (string, error) { return s.home, nil }
+	s.chdir(filepath.Join(s.project, "lib", "stacks"))
+
+	s.T().Setenv("CDKPW_CONFIG", "")
+	s.T().Setenv("AWS_CONFIG_FILE", filepath.Join(s.home, "missing"))
+}
+
+// TestMain keeps the real /etc/cdkpw.yml and ~/.cdk/.cdkpw.yml out of the tests.
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "cdkpw-home")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	systemConfigFile = filepath.Join(home, "cdkpw.yml")
+
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+func (s *layersSuite) TearDownTest() {
+	s.restore()
+}
+
+func (s *layersSuite) chdir(dir string) {
+	getWorkingDir = func() (string, error) { return dir, nil }
+}
+
+func (s *layersSuite) writeGlobal(content string) {
+	s.Require().NoError(os.MkdirAll(filepath.Join(s.home, ".cdk"), 0700))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.home, ".cdk", defaultConfigFile), []byte(content), 0600))
+}
+
+func (s *layersSuite) writeProject(dir, content string) string {
+	path := filepath.Join(dir, defaultConfigFile)
+	s.Require().NoError(os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func (s *layersSuite) TestMerge() {
+	config := Config{
+		Profiles:    []Profile{{Match: "Prod", Profile: "prod_admin"}},
+		CdkLocation: "/usr/bin/cdk",
+		Verbose:     INFO,
+	}
+
+	config.merge(Config{
+		Profiles:   []Profile{{Match: "Api", Profile: "api_admin"}},
+		Verbose:    SILENT,
+		Resolution: ResolveFirst,
+	}, map[string]bool{"profiles": true, "verbose": true}, "project.yml")
+
+	s.Equal([]Profile{{Match: "Api", Profile: "api_admin", origin: "project.yml"}, {Match: "Prod", Profile: "prod_admin"}}, config.Profiles)
+	s.Equal("/usr/bin/cdk", config.CdkLocation, "unset keys are kept")
+	s.Equal(SILENT, config.Verbose, "explicit zero values override")
+	s.Empty(config.Resolution, "values without their key are ignored")
+}
+
+func (s *layersSuite) TestFindProjectConfig() {
+	s.Run("none", func() {
+		_, ok := findProjectConfig()
+		s.False(ok)
+	})
+
+	s.Run("at project root", func() {
+		path := s.writeProject(s.project, "verbose: 1\n")
+		found, ok := findProjectConfig()
+		s.True(ok)
+		s.Equal(path, found)
+	})
+
+	s.Run("nearest wins", func() {
+		path := s.writeProject(filepath.Join(s.project, "lib"), "verbose: 2\n")
+		found, ok := findProjectConfig()
+		s.True(ok)
+		s.Equal(path, found)
+	})
+
+	s.Run("stops at the project root", func() {
+		s.Require().NoError(os.Remove(filepath.Join(s.project, "lib", defaultConfigFile)))
+		s.Require().NoError(os.Remove(filepath.Join(s.project, defaultConfigFile)))
+		s.writeProject(filepath.Dir(s.project), "verbose: 2\n")
+		_, ok := findProjectConfig()
+		s.False(ok)
+	})
+
+	s.Run("outside a cdk project", func() {
+		s.chdir(s.home)
+		_, ok := findProjectConfig()
+		s.False(ok)
+	})
+}
+
+func (s *layersSuite) TestLoadConfig_OtherFormats() {
+	s.writeGlobal("verbose: 1\n")
+	path := filepath.Join(s.project, "lib", ".cdkpw.toml")
+	s.Require().NoError(os.WriteFile(path, []byte("[[profiles]]\nmatch = \"Prod\"\nprofile = \"prod_admin\"\n"), 0600))
+
+	config, err := loadConfig()
+	s.Require().NoError(err)
+	s.Equal(INFO, config.Verbose)
+	s.Equal([]string{filepath.Join(s.home, ".cdk", defaultConfigFile), path}, config.sources)
+	s.Equal("prod_admin", config.Profiles[0].Profile)
+
+	s.Require().NoError(os.Remove(filepath.Join(s.home, ".cdk", defaultConfigFile)))
+	userPath := filepath.Join(s.home, ".cdk", ".cdkpw.json")
+	s.Require().NoError(os.WriteFile(userPath, []byte(`{"verbose": 2}`), 0600))
+	config, err = loadConfig()
+	s.Require().NoError(err)
+	s.Equal(DEBUG, config.Verbose)
+	s.Equal([]string{userPath, path}, config.sources)
+}
+
+func (s *layersSuite) TestLoadConfig_ProjectOnTopOfGlobal() {
+	s.writeGlobal("cdkLocation: /opt/cdk\nverbose: 1\nprofiles:\n  - match: Prod\n    profile: prod_admin\n")
+	s.writeProject(s.project, "verbose: 0\nprofiles:\n  - match: Prod\n    profile: team_prod\n")
+
+	config, err := loadConfig()
+	s.Require().NoError(err)
+	s.Equal("/opt/cdk", config.CdkLocation)
+	s.Equal(SILENT, config.Verbose)
+
+	profile, ok, err := config.findTarget(stackTarget{Name: "ProdApi"})
+	s.Require().NoError(err)
+	s.True(ok)
+	s.Equal("team_prod", profile)
+}
+
+func (s *layersSuite) TestLoadConfig_CDKJSONBlock() {
+	cdkJSON := filepath.Join(s.project, cdkJSONFile)
+	s.Require().NoError(os.MkdirAll(filepath.Join(s.project, "rules"), 0700))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.project, "rules", "shared.yml"), []byte("profiles:\n  - match: Dev\n    profile: dev_admin\n"), 0600))
+	s.Require().NoError(os.WriteFile(cdkJSON, []byte(`{
+  "app": "npx ts-node bin/app.ts",
+  "context": {"stage": "dev"},
+  "cdkpw": {
+    "include": ["rules/shared.yml"],
+    "verbose": 1,
+    "profiles": [{"match": "Prod", "profile": "prod_admin"}]
+  }
+}`), 0600))
+
+	config, err := loadConfig()
+	s.Require().NoError(err)
+	s.Equal([]string{cdkJSON}, config.sources)
+	s.Equal(INFO, config.Verbose)
+	s.Equal(cdkJSON, config.origins["verbose"])
+	s.Equal([]Profile{{Match: "Prod", Profile: "prod_admin"}, {Match: "Dev", Profile: "dev_admin"}}, stripRules(config.Profiles))
+
+	s.Run("a project file wins", func() {
+		path := s.writeProject(s.project, "verbose: 2\n")
+		config, err := loadConfig()
+		s.Require().NoError(err)
+		s.Equal([]string{cdkJSON, path}, config.sources)
+		s.Equal(DEBUG, config.Verbose)
+		s.Require().NoError(os.Remove(path))
+	})
+
+	s.Run("errors point into cdk.json", func() {
+		s.Require().NoError(os.WriteFile(cdkJSON, []byte(`{
+  "app": "npx ts-node bin/app.ts",
+  "cdkpw": {
+    "verbos": 1
+  }
+}`), 0600))
+		_, err := loadConfig()
+		s.Require().Error(err)
+		s.Contains(err.Error(), cdkJSON+`:4:5: unknown key "verbos", did you mean "verbose"?`)
+	})
+}
+
+func (s *layersSuite) TestLoadConfig_ProjectOnly() {
+	s.writeProject(s.project, "profiles:\n  - match: Dev\n    profile: dev_admin\n")
+
+	config, err := loadConfig()
+	s.Require().NoError(err)
+	s.Equal("cdk", config.CdkLocation)
+	s.Len(config.Profiles, 1)
+}
+
+func (s *layersSuite) TestLoadConfig_Errors() {
+	s.Run("nothing to load", func() {
+		_, err := loadConfig()
+		s.Require().Error(err)
+		s.Contains(err.Error(), "could not read config file at")
+	})
+
+	s.Run("explicit CDKPW_CONFIG must exist", func() {
+		s.writeProject(s.project, "verbose: 1\n")
+		s.T().Setenv("CDKPW_CONFIG", filepath.Join(s.home, "missing.yml"))
+		_, err := loadConfig()
+		s.Require().Error(err)
+	})
+
+	s.Run("broken project config", func() {
+		s.T().Setenv("CDKPW_CONFIG", "")
+		path := s.writeProject(s.project, "profiles: [")
+		_, err := loadConfig()
+		s.Require().Error(err)
+		s.Contains(err.Error(), "invalid YAML in "+path)
+	})
+}
+
+func (s *layersSuite) TestLoadConfig_MissingInclude() {
+	s.writeGlobal("profiles:\n  - match: Prod\n    profile: dev_oops\n")
+	path := s.writeProject(s.project, "include:\n  - shared/missing.yml\nprofiles:\n  - match: Prod\n    profile: prod_admin\n")
+
+	_, err := loadConfig()
+	s.Require().Error(err, "a layer with a missing include must not be skipped")
+	s.Contains(err.Error(), `include "shared/missing.yml" in `+path)
+
+	s.Run("in the cdk.json block", func() {
+		s.Require().NoError(os.Remove(path))
+		s.Require().NoError(os.WriteFile(filepath.Join(s.project, cdkJSONFile), []byte(`{"app": "x", "cdkpw": {"include": ["shared/missing.yml"]}}`), 0600))
+		_, err := loadConfig()
+		s.Require().Error(err)
+		s.Contains(err.Error(), `include "shared/missing.yml"`)
+	})
+}
+
+func (s *layersSuite) TestLoadConfig_SettingsAcrossLayers() {
+	s.writeGlobal("defaultProfile: sandbox\n")
+	path := s.writeProject(s.project, "onNoMatch: default\n")
+
+	_, _, err := readConfigFile(path)
+	s.Require().NoError(err, "the project file alone is valid")
+	config, err := loadConfig()
+	s.Require().NoError(err)
+	s.Equal(NoMatchDefault, config.OnNoMatch)
+	s.Equal("sandbox", config.DefaultProfile)
+
+	s.Run("actions added in another layer", func() {
+		s.writeGlobal("defaultProfile: sandbox\nprofiledActions: [publish-assets]\n")
+		s.writeProject(s.project, "profiles:\n  - match: Prod\n    profile: prod_admin\n    actions:\n      publish-assets: prod_deployer\n")
+		_, _, err := readConfigFile(path)
+		s.Require().NoError(err)
+		config, err := loadConfig()
+		s.Require().NoError(err)
+		s.Equal("prod_deployer", config.Profiles[0].profileFor("publish-assets"))
+	})
+
+	s.Run("still required once merged", func() {
+		s.writeGlobal("verbose: 0\n")
+		s.writeProject(s.project, "onNoMatch: default\n")
+		_, err := loadConfig()
+		s.Require().Error(err)
+		s.Contains(err.Error(), "onNoMatch default needs a defaultProfile")
+	})
+}
+
+func (s *layersSuite) TestLoadConfig_Precedence() {
+	system := filepath.Join(s.home, "system.yml")
+	original := systemConfigFile
+	systemConfigFile = system
+	defer func() { systemConfigFile = original }()
+
+	s.Require().NoError(os.WriteFile(system, []byte(`
+cdkLocation: /usr/bin/cdk
+resolution: error
+profiles:
+  - name: prod
+    match: Prod
+    profile: org_prod
+  - match: Shared
+    profile: org_shared
+`), 0600))
+	s.writeGlobal("verbose: 1\nprofiles:\n  - match: Sandbox\n    profile: my_sandbox\n")
+	s.writeProject(s.project, "split: true\nprofiles:\n  - name: prod\n    match: Prod\n    profile: team_prod\n")
+	custom := filepath.Join(s.home, "custom.yml")
+	s.Require().NoError(os.WriteFile(custom, []byte("cdkLocation: /opt/cdk\n"), 0600))
+	s.T().Setenv("CDKPW_CONFIG", custom)
+	s.T().Setenv("CDKPW_VERBOSE", "2")
+	s.T().Setenv("CDKPW_RESOLUTION", "first")
+
+	config, err := loadConfig()
+	s.Require().NoError(err)
+
+	s.Equal("/opt/cdk", config.CdkLocation)
+	s.Equal(DEBUG, config.Verbose)
+	s.Equal(ResolveFirst, config.Resolution)
+	s.True(config.Split)
+
+	var rules []string
+	for _, rule := range config.Profiles {
+		rules = append(rules, rule.Profile+"@"+filepath.Base(rule.origin))
+	}
+	s.Equal([]string{"my_sandbox@.cdkpw.yml", "team_prod@.cdkpw.yml", "org_shared@system.yml"}, rules)
+	s.Equal(filepath.Join(s.project, defaultConfigFile), config.Profiles[1].origin)
+
+	s.Equal(map[string]string{
+		"cdkLocation": custom,
+		"verbose":     "env CDKPW_VERBOSE",
+		"resolution":  "env CDKPW_RESOLUTION",
+		"split":       filepath.Join(s.project, defaultConfigFile),
+		"profiles":    filepath.Join(s.project, defaultConfigFile),
+	}, config.origins)
+}
+
+func (s *layersSuite) TestLoadConfig_EnvOverrideErrors() {
+	s.writeGlobal("verbose: 1\n")
+	s.T().Setenv("CDKPW_VERBOSE", "loud")
+
+	_, err := loadConfig()
+	s.Require().Error(err)
+	s.Contains(err.Error(), "invalid CDKPW_VERBOSE")
+}
+
+func (s *layersSuite) TestEnvName() {
+	s.Equal("CDKPW_VERBOSE", envName("verbose"))
+	s.Equal("CDKPW_CDK_LOCATION", envName("cdkLocation"))
+	s.Equal("CDKPW_INFER_PROFILES", envName("inferProfiles"))
+}
+
+func TestLayersSuite(t *testing.T) {
+	suite.Run(t, new(layersSuite))
+}
@@ -3,9 +3,18 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 )
 
 func main() {
+	if run, ok := lookupSubcommand(os.Args[1:]); ok {
+		if err := run(os.Args[2:], os.Stdout); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	cdkCommand := parseArgs(os.Args[1:])
 
 	config, err := loadConfig()
@@ -14,14 +23,33 @@ func main() {
 		os.Exit(1)
 	}
 
-	if !cdkCommand.IsProfiled() {
-		switch cdkCommand.Action {
-		case "diff", "deploy", "destroy", "bootstrap":
-			if profile, found := config.findProfile(cdkCommand.StackName); found {
-				cdkCommand.SetProfile(profile)
-			}
-		default:
-			//  do nothing
+	action, profiled := config.profiledAction(cdkCommand.Action)
+	cdkCommand.useAction(action)
+	if !cdkCommand.IsProfiled() && profiled {
+		if err := cdkCommand.selectStacks(config.CdkLocation, config.needsEnvironment()); err != nil {
+			fmt.Println("Error selecting stacks:", err)
+			os.Exit(1)
+		}
+		if config.Verbose >= INFO && len(cdkCommand.Targets) > 0 && hasGlob(cdkCommand.Stacks) {
+			fmt.Printf("cdkpw: Selected stacks %s\n", strings.Join(cdkCommand.Targets, ", "))
+		}
+		if err := config.applyProfiles(cdkCommand); err != nil {
+			fmt.Println("Error resolving profile:", err)
+			os.Exit(1)
+		}
+	}
+
+	if profiled && action.Verify {
+		if err := config.verifyAccounts(cdkCommand); err != nil {
+			fmt.Println("Error verifying accounts:", err)
+			os.Exit(1)
+		}
+	}
+
+	for _, profile := range cdkCommand.profiles() {
+		if err := config.ensureSSOLogin(profile); err != nil {
+			fmt.Println("Error logging in:", err)
+			os.Exit(1)
 		}
 	}
 
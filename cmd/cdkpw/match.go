@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MatchType controls how Profile.Match is compared against a stack name.
+type MatchType string
+
+const (
+	MatchSubstring MatchType = "substring" // default, stack name contains Match
+	MatchPrefix    MatchType = "prefix"
+	MatchSuffix    MatchType = "suffix"
+	MatchGlob      MatchType = "glob"  // * and ? within a path segment, ** across segments
+	MatchRegex     MatchType = "regex" // Go regexp syntax, unanchored unless the pattern says so
+)
+
+// compile validates the rule and prepares its pattern so matching never fails later on.
+func (p *Profile) compile() error {
+	p.re = nil
+	switch p.MatchType {
+	case "", MatchSubstring, MatchPrefix, MatchSuffix:
+		return nil
+	case MatchGlob:
+		re, err := regexp.Compile(globToRegexp(p.Match))
+		if err != nil {
+			return fmt.Errorf("invalid glob %q: %w", p.Match, err)
+		}
+		p.re = re
+	case MatchRegex:
+		re, err := regexp.Compile(p.Match)
+		if err != nil {
+			return fmt.Errorf("invalid regex %q: %w", p.Match, err)
+		}
+		p.re = re
+	default:
+		return fmt.Errorf("unknown matchType %q", p.MatchType)
+	}
+	return nil
+}
+
+// matchesTarget applies every selector the rule sets, an account rule without Match matches all stacks in the account.
+func (p *Profile) matchesTarget(target stackTarget) bool {
+	if p.Account != "" && p.Account != target.Account {
+		return false
+	}
+	if p.Region != "" && p.Region != target.Region {
+		return false
+	}
+	for key, value := range p.Context {
+		if actual, ok := target.Context[key]; !ok || actual != value {
+			return false
+		}
+	}
+	if p.Match == "" && (p.environmentSelectors() > 0 || len(p.Context) > 0) {
+		return true
+	}
+	return p.matches(target.Name)
+}
+
+func (p *Profile) matches(stackArg string) bool {
+	switch p.MatchType {
+	case "", MatchSubstring:
+		return strings.Contains(stackArg, p.Match)
+	case MatchPrefix:
+		return strings.HasPrefix(stackArg, p.Match)
+	case MatchSuffix:
+		return strings.HasSuffix(stackArg, p.Match)
+	}
+
+	// Rules built in code skip loadConfig, compile them on first use
+	if p.re == nil && p.compile() != nil {
+		return false
+	}
+	return p.re.MatchString(stackArg)
+}
+
+// globToRegexp translates a glob into an anchored regular expression.
+// `*` and `?` stay within a path segment, `**` spans segments.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
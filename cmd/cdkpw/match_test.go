@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type matchSuite struct {
+	suite.Suite
+}
+
+func (s *matchSuite) TestProfileMatches() {
+	tests := []struct {
+		name     string
+		rule     Profile
+		stackArg string
+		want     bool
+	}{
+		{name: "substring default", rule: Profile{Match: "Dev"}, stackArg: "DevicesProdStack", want: true},
+		{name: "substring explicit", rule: Profile{Match: "Api", MatchType: MatchSubstring}, stackArg: "CustomerApiStack", want: true},
+		{name: "prefix hit", rule: Profile{Match: "Dev", MatchType: MatchPrefix}, stackArg: "DevApiStack", want: true},
+		{name: "prefix miss", rule: Profile{Match: "Dev", MatchType: MatchPrefix}, stackArg: "ProdDevStack", want: false},
+		{name: "suffix hit", rule: Profile{Match: "-prod", MatchType: MatchSuffix}, stackArg: "api-prod", want: true},
+		{name: "suffix miss", rule: Profile{Match: "-prod", MatchType: MatchSuffix}, stackArg: "prod-api", want: false},
+		{name: "glob star", rule: Profile{Match: "Dev*Stack", MatchType: MatchGlob}, stackArg: "DevApiStack", want: true},
+		{name: "glob is anchored", rule: Profile{Match: "Api*", MatchType: MatchGlob}, stackArg: "CustomerApiStack", want: false},
+		{name: "glob question mark", rule: Profile{Match: "Dev?", MatchType: MatchGlob}, stackArg: "DevApi", want: false},
+		{name: "glob star stays in segment", rule: Profile{Match: "Prod/*", MatchType: MatchGlob}, stackArg: "Prod/Api/Db", want: false},
+		{name: "glob double star crosses segments", rule: Profile{Match: "Prod/**", MatchType: MatchGlob}, stackArg: "Prod/Api/Db", want: true},
+		{name: "glob escapes regex chars", rule: Profile{Match: "Api.v1", MatchType: MatchGlob}, stackArg: "Apixv1", want: false},
+		{name: "regex anchored", rule: Profile{Match: "^Dev(Api|Worker)Stack$", MatchType: MatchRegex}, stackArg: "DevApiStack", want: true},
+		{name: "regex anchored miss", rule: Profile{Match: "^Dev(Api|Worker)Stack$", MatchType: MatchRegex}, stackArg: "DevicesProdStack", want: false},
+		{name: "invalid regex never matches", rule: Profile{Match: "(", MatchType: MatchRegex}, stackArg: "(", want: false},
+		{name: "unknown type never matches", rule: Profile{Match: "Dev", MatchType: "fuzzy"}, stackArg: "Dev", want: false},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.Equal(tt.want, tt.rule.matches(tt.stackArg))
+		})
+	}
+}
+
+func (s *matchSuite) TestCompile() {
+	s.NoError((&Profile{Match: "Dev*", MatchType: MatchGlob}).compile())
+	s.NoError((&Profile{Match: "^Dev$", MatchType: MatchRegex}).compile())
+
+	err := (&Profile{Match: "([", MatchType: MatchRegex}).compile()
+	s.Require().Error(err)
+	s.Contains(err.Error(), "invalid regex")
+
+	err = (&Profile{Match: "Dev", MatchType: "fuzzy"}).compile()
+	s.Require().Error(err)
+	s.Contains(err.Error(), `unknown matchType "fuzzy"`)
+}
+
+func (s *matchSuite) TestFindProfile_AnchoredRules() {
+	config := &Config{
+		Profiles: []Profile{
+			{Match: "Dev", MatchType: MatchPrefix, Profile: "dev_admin"},
+			{Match: "ProdStack", MatchType: MatchSuffix, Profile: "prod_admin"},
+		},
+	}
+
+	profile, ok, err := config.findTarget(stackTarget{Name: "DevicesProdStack"})
+	s.Require().NoError(err)
+	s.True(ok)
+	s.Equal("prod_admin", profile)
+}
+
+func (s *matchSuite) TestLoadConfig_BadPattern() {
+	yamlContent := `
+profiles:
+  - match: Prod
+    profile: prod_admin
+  - match: "(Dev"
+    matchType: regex
+    profile: dev_admin
+`
+	configPath := filepath.Join(s.T().TempDir(), "config.yml")
+	s.Require().NoError(os.WriteFile(configPath, []byte(yamlContent), 0600))
+	s.T().Setenv("CDKPW_CONFIG", configPath)
+	s.T().Setenv("AWS_CONFIG_FILE", filepath.Join(s.T().TempDir(), "missing"))
+
+	_, err := loadConfig()
+	s.Require().Error(err)
+	s.Contains(err.Error(), "profile rule 2")
+	s.Contains(err.Error(), "invalid regex")
+}
+
+func TestMatchSuite(t *testing.T) {
+	suite.Run(t, new(matchSuite))
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// promptOutput receives the interactive prompts, stdout is left to cdk.
+	promptOutput io.Writer = os.Stderr
+
+	stdinReader *bufio.Reader
+	stdinSource io.Reader
+)
+
+// inputReader buffers stdin once, so several prompts in a run do not lose each other's input.
+func inputReader() *bufio.Reader {
+	if stdinReader == nil || stdinSource != stdin {
+		stdinReader, stdinSource = bufio.NewReader(stdin), stdin
+	}
+	return stdinReader
+}
+
+// interactive reports whether cdkpw may ask the user instead of applying the non-interactive behaviour.
+func (c *Config) interactive() bool {
+	return !c.noPrompt && stdinIsTerminal()
+}
+
+// profileChoice is an entry of the picker.
+type profileChoice struct {
+	Profile string
+	Note    string
+}
+
+// profileChoices lists the disagreeing rules first, then every other rule, the defaultProfile and the aws profiles.
+func (c *Config) profileChoices(res Resolution) []profileChoice {
+	var choices []profileChoice
+	seen := map[string]bool{}
+	add := func(profile, note string) {
+		if profile != "" && !seen[profile] {
+			seen[profile] = true
+			choices = append(choices, profileChoice{profile, note})
+		}
+	}
+
+	for _, rule := range res.Candidates {
+		add(rule.profileFor(res.Action), "matches: "+rule.describe())
+	}
+	for _, rule := range c.Profiles {
+		add(rule.profileFor(res.Action), "rule: "+rule.describe())
+	}
+	add(c.DefaultProfile, "defaultProfile")
+	if aws := c.awsProfiles(); aws != nil {
+		for _, name := range aws.profileNames() {
+			note := ""
+			if account := aws.Profiles[name]["sso_account_id"]; account != "" {
+				note = "account " + account
+			}
+			add(name, note)
+		}
+	}
+	return choices
+}
+
+// pickProfile asks for the profile of a stack the rules did not settle and offers to save the answer as a rule.
+func (c *Config) pickProfile(res Resolution) (string, bool, error) {
+	title := fmt.Sprintf("No rule matches %s", stackLabel(res.Stack))
+	if len(res.Candidates) > 0 {
+		title = fmt.Sprintf("Rules disagree on %s", stackLabel(res.Stack))
+	}
+
+	profile, err := pickFrom(title, c.profileChoices(res), inputReader(), promptOutput)
+	if err != nil {
+		return "", false, fmt.Errorf("no profile chosen for %s: %w", stackLabel(res.Stack), err)
+	}
+	if res.Stack != "" {
+		if err := c.offerSave(res, profile); err != nil {
+			return "", false, err
+		}
+	}
+
+	if c.Verbose >= INFO {
+		fmt.Printf("cdkpw: Using profile %s for stack %s\n", profile, res.Stack)
+	}
+	return profile, true, nil
+}
+
+// pickFrom shows a filterable list: a number or a profile name picks, other text narrows the list
+// and an empty answer picks the only entry left or shows the full list again.
+func pickFrom(title string, choices []profileChoice, in *bufio.Reader, out io.Writer) (string, error) {
+	if len(choices) == 0 {
+		return "", errors.New("no profiles to pick from")
+	}
+
+	fmt.Fprintf(out, "cdkpw: %s\n", title)
+	filter := ""
+	for {
+		shown := filterChoices(choices, filter)
+		for i, choice := range shown {
+			fmt.Fprintf(out, "  %2d) %s", i+1, choice.Profile)
+			if choice.Note != "" {
+				fmt.Fprintf(out, "  (%s)", choice.Note)
+			}
+			fmt.Fprintln(out)
+		}
+		fmt.Fprint(out, "Profile number, name or text to filter: ")
+
+		line, err := in.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		answer := strings.TrimSpace(line)
+		if answer == "" && errors.Is(err, io.EOF) {
+			fmt.Fprintln(out)
+			return "", errors.New("no answer")
+		}
+
+		if n, convErr := strconv.Atoi(answer); convErr == nil && n >= 1 && n <= len(shown) {
+			return shown[n-1].Profile, nil
+		}
+		for _, choice := range choices {
+			if choice.Profile == answer {
+				return answer, nil
+			}
+		}
+
+		switch {
+		case answer == "" && len(shown) == 1:
+			return shown[0].Profile, nil
+		case answer == "":
+			filter = ""
+		case len(filterChoices(choices, answer)) == 0:
+			fmt.Fprintf(out, "No profile matches %q\n", answer)
+		default:
+			filter = answer
+		}
+		if errors.Is(err, io.EOF) {
+			return "", errors.New("no answer")
+		}
+	}
+}
+
+func filterChoices(choices []profileChoice, filter string) []profileChoice {
+	if filter == "" {
+		return choices
+	}
+	var shown []profileChoice
+	for _, choice := range choices {
+		if strings.Contains(strings.ToLower(choice.Profile+" "+choice.Note), strings.ToLower(filter)) {
+			shown = append(shown, choice)
+		}
+	}
+	return shown
+}
+
+// offerSave asks whether the picked profile should become a rule in the highest precedence config file.
+func (c *Config) offerSave(res Resolution, profile string) error {
+	path := c.saveTarget()
+	if path == "" {
+		return nil
+	}
+
+	fmt.Fprintf(promptOutput, "Save %s -> %s as a rule in %s? [y/N] ", res.Stack, profile, path)
+	line, err := inputReader().ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if answer := strings.ToLower(strings.TrimSpace(line)); answer != "y" && answer != "yes" {
+		return nil
+	}
+
+	rule := stackRule(res, profile)
+	if err := saveRule(path, rule); err != nil {
+		return fmt.Errorf("could not save rule to %s: %w", path, err)
+	}
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	rule.origin = path
+	c.Profiles = append([]Profile{rule}, c.Profiles...)
+	fmt.Fprintf(promptOutput, "cdkpw: Saved rule %s to %s\n", rule.describe(), path)
+	return nil
+}
+
+// saveTarget is the last config file that was loaded, the cdkpw block of cdk.json is left alone.
+func (c *Config) saveTarget() string {
+	for i := len(c.sources) - 1; i >= 0; i-- {
+		if filepath.Base(c.sources[i]) != cdkJSONFile {
+			return c.sources[i]
+		}
+	}
+	return ""
+}
+
+// stackRule matches exactly the stack of res, and outranks the rules that disagreed on it.
+func stackRule(res Resolution, profile string) Profile {
+	rule := Profile{Match: res.Stack, MatchType: MatchGlob, Profile: profile}
+	if strings.HasPrefix(res.Stack, "aws://") && res.Account != "" && res.Region != "" {
+		rule = Profile{Account: res.Account, Region: res.Region, Profile: profile}
+	} else if strings.ContainsAny(res.Stack, "*?[") {
+		rule.Match, rule.MatchType = "^"+regexp.QuoteMeta(res.Stack)+"$", MatchRegex
+	}
+	for _, candidate := range res.Candidates {
+		if candidate.Priority >= rule.Priority {
+			rule.Priority = candidate.Priority + 1
+		}
+		if candidate.Account != "" {
+			rule.Account = res.Account
+		}
+		for key := range candidate.Context {
+			if rule.Context == nil {
+				rule.Context = map[string]string{}
+			}
+			rule.Context[key] = res.Context[key]
+		}
+	}
+	return rule
+}
+
+// saveRule adds rule ahead of the other rules of the file at path. YAML files are edited in place
+// to keep their comments, JSON and TOML files are rewritten.
+func saveRule(path string, rule Profile) error {
+	if formatOf(path) != formatYAML {
+		config, keys, err := readConfigFile(path)
+		if err != nil {
+			return err
+		}
+		config.Profiles = append([]Profile{rule}, config.Profiles...)
+		keys["profiles"] = true
+		data, err := encodeConfig(config, keys, formatOf(path))
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, data, 0o644)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	if len(root.Content) == 0 {
+		root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	doc := root.Content[0]
+
+	var item yaml.Node
+	if err := item.Encode(rule); err != nil {
+		return err
+	}
+	var profiles *yaml.Node
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == "profiles" {
+			profiles = doc.Content[i+1]
+		}
+	}
+	if profiles == nil || profiles.Kind != yaml.SequenceNode {
+		profiles = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "profiles"}, profiles)
+	}
+	profiles.Content = append([]*yaml.Node{&item}, profiles.Content...)
+
+	var b strings.Builder
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&root); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type pickerSuite struct {
+	suite.Suite
+	out     bytes.Buffer
+	restore func()
+}
+
+func (s *pickerSuite) SetupTest() {
+	s.out.Reset()
+	writeAWSConfig(s.T(), testAWSConfig)
+
+	originalTerminal, originalStdin, originalOutput := stdinIsTerminal, stdin, promptOutput
+	s.restore = func() { stdinIsTerminal, stdin, promptOutput = originalTerminal, originalStdin, originalOutput }
+	stdinIsTerminal = func() bool { return true }
+	promptOutput = &s.out
+}
+
+func (s *pickerSuite) TearDownTest() {
+	s.restore()
+}
+
+func (s *pickerSuite) conflicting() *Config {
+	return &Config{
+		Resolution: ResolvePrompt,
+		Profiles: []Profile{
+			{Match: "Prod", Profile: "prod_admin", Priority: 1},
+			{Match: "Api", Profile: "prod_readonly", Priority: 1},
+			{Match: "Dev", Profile: "dev_admin"},
+		},
+	}
+}
+
+func (s *pickerSuite) TestPickFrom() {
+	choices := []profileChoice{{"prod_admin", "account 111111111111"}, {"prod_readonly", ""}, {"dev_admin", ""}}
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		err   string
+	}{
+		{name: "number", input: "2\n", want: "prod_readonly"},
+		{name: "name", input: "dev_admin\n", want: "dev_admin"},
+		{name: "filter then number", input: "prod\n2\n", want: "prod_readonly"},
+		{name: "filter on notes", input: "1111\n\n", want: "prod_admin"},
+		{name: "no match keeps the list", input: "staging\n3\n", want: "dev_admin"},
+		{name: "number out of range filters", input: "9\n1\n", want: "prod_admin"},
+		{name: "end of input", input: "prod\n", err: "no answer"},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			got, err := pickFrom("Pick", choices, bufio.NewReader(strings.NewReader(tt.input)), &bytes.Buffer{})
+			if tt.err != "" {
+				s.EqualError(err, tt.err)
+				return
+			}
+			s.Require().NoError(err)
+			s.Equal(tt.want, got)
+		})
+	}
+
+	_, err := pickFrom("Pick", nil, bufio.NewReader(strings.NewReader("")), &bytes.Buffer{})
+	s.EqualError(err, "no profiles to pick from")
+}
+
+func (s *pickerSuite) TestProfileChoices() {
+	config := s.conflicting()
+	config.DefaultProfile = "default"
+	res, err := config.resolveTarget(stackTarget{Name: "ProdApi"})
+	s.Require().NoError(err)
+
+	var profiles []string
+	for _, choice := range config.profileChoices(res) {
+		profiles = append(profiles, choice.Profile)
+	}
+	s.Equal([]string{"prod_admin", "prod_readonly", "dev_admin", "default"}, profiles)
+	s.Equal(`matches: substring "Prod" -> prod_admin (priority 1)`, config.profileChoices(res)[0].Note)
+}
+
+func (s *pickerSuite) TestResolvePrompt() {
+	config := s.conflicting()
+
+	res, err := config.resolveTarget(stackTarget{Name: "ProdApi"})
+	s.Require().NoError(err)
+	s.True(res.Prompt)
+	s.Equal("matching rules disagree, asking for a profile", res.Reason)
+
+	res, err = config.resolveTarget(stackTarget{Name: "DevApi"})
+	s.Require().NoError(err)
+	s.Equal("prod_readonly", res.Winner.Profile, "the higher priority rule wins without asking")
+
+	stdin = strings.NewReader("prod_readonly\n")
+	profile, ok, err := config.findTarget(stackTarget{Name: "ProdApi"})
+	s.Require().NoError(err)
+	s.True(ok)
+	s.Equal("prod_readonly", profile)
+	s.Contains(s.out.String(), "cdkpw: Rules disagree on stack ProdApi")
+
+	stdinIsTerminal = func() bool { return false }
+	_, err = config.resolveTarget(stackTarget{Name: "ProdApi"})
+	s.Require().Error(err)
+	s.Contains(err.Error(), `stack ProdApi matches conflicting rules: substring "Prod" -> prod_admin (priority 1); substring "Api" -> prod_readonly (priority 1)`)
+}
+
+func (s *pickerSuite) TestSaveChosenRule() {
+	path := filepath.Join(s.T().TempDir(), "config.yml")
+	s.Require().NoError(os.WriteFile(path, []byte("# team rules\nresolution: prompt\nprofiles:\n  # production\n  - match: Prod\n    profile: prod_admin\n  - match: Api\n    profile: prod_readonly\n"), 0600))
+	s.T().Setenv("CDKPW_CONFIG", path)
+
+	config, err := loadConfig()
+	s.Require().NoError(err)
+
+	stdin = strings.NewReader("1\ny\n")
+	profile, _, err := config.findTarget(stackTarget{Name: "ProdApi"})
+	s.Require().NoError(err)
+	s.Equal("prod_admin", profile)
+	s.Contains(s.out.String(), `cdkpw: Saved rule glob "ProdApi" -> prod_admin (priority 1) to `+path)
+
+	data, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Equal("# team rules\nresolution: prompt\nprofiles:\n  - match: ProdApi\n    matchType: glob\n    profile: prod_admin\n    priority: 1\n  # production\n  - match: Prod\n    profile: prod_admin\n  - match: Api\n    profile: prod_readonly\n", string(data))
+
+	stdinIsTerminal = func() bool { return false }
+	config, err = loadConfig()
+	s.Require().NoError(err)
+	profile, _, err = config.findTarget(stackTarget{Name: "ProdApi"})
+	s.Require().NoError(err)
+	s.Equal("prod_admin", profile, "the saved rule settles the conflict")
+}
+
+func (s *pickerSuite) TestSaveRuleTOML() {
+	path := filepath.Join(s.T().TempDir(), ".cdkpw.toml")
+	s.Require().NoError(os.WriteFile(path, []byte("verbose = 1\n"), 0600))
+
+	s.Require().NoError(saveRule(path, Profile{Match: "Stage/*", MatchType: MatchGlob, Profile: "staging_admin"}))
+	config, _, err := readConfigFile(path)
+	s.Require().NoError(err)
+	s.Equal(INFO, config.Verbose)
+	s.Equal([]Profile{{Match: "Stage/*", MatchType: MatchGlob, Profile: "staging_admin"}}, stripRules(config.Profiles))
+}
+
+func (s *pickerSuite) TestStackRule() {
+	rule := stackRule(Resolution{Stack: "Stage/Api", Account: "111111111111", Candidates: []Profile{
+		{Match: "Api", Profile: "a", Priority: 2},
+		{Account: "111111111111", Profile: "b"},
+	}}, "a")
+	s.Equal(Profile{Match: "Stage/Api", MatchType: MatchGlob, Profile: "a", Priority: 3, Account: "111111111111"}, rule)
+
+	rule = stackRule(Resolution{Stack: "Odd[1]"}, "a")
+	s.Equal(Profile{Match: `^Odd\[1\]$`, MatchType: MatchRegex, Profile: "a"}, rule)
+	s.Require().NoError(rule.compile())
+	s.True(rule.matches("Odd[1]"))
+
+	rule = stackRule(Resolution{Stack: "aws://111111111111/eu-west-1", Account: "111111111111", Region: "eu-west-1"}, "a")
+	s.Equal(Profile{Account: "111111111111", Region: "eu-west-1", Profile: "a"}, rule)
+
+	rule = stackRule(Resolution{Stack: "Api", Context: map[string]string{"stage": "prod", "team": "a"}, Candidates: []Profile{
+		{Context: map[string]string{"stage": "prod"}, Profile: "b"},
+	}}, "a")
+	s.Equal(Profile{Match: "Api", MatchType: MatchGlob, Profile: "a", Priority: 1, Context: map[string]string{"stage": "prod"}}, rule)
+}
+
+func TestPickerSuite(t *testing.T) {
+	suite.Run(t, new(pickerSuite))
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ResolutionMode decides which rule wins when several rules match a stack.
+type ResolutionMode string
+
+const (
+	ResolveLongest  ResolutionMode = "longest"  // default, longest Match wins, ties go to the first rule
+	ResolveFirst    ResolutionMode = "first"    // first matching rule in config order
+	ResolvePriority ResolutionMode = "priority" // highest Priority wins, then longest Match, then order
+	ResolveError    ResolutionMode = "error"    // refuse to pick when matching rules disagree
+	ResolvePrompt   ResolutionMode = "prompt"   // like priority, but ask when the highest priority rules disagree
+)
+
+// OnNoMatchMode decides what happens to a stack that no rule matches.
+type OnNoMatchMode string
+
+const (
+	NoMatchPassthrough OnNoMatchMode = "passthrough" // run cdk with the ambient credentials, the default without defaultProfile
+	NoMatchDefault     OnNoMatchMode = "default"     // use defaultProfile, the default when it is set
+	NoMatchError       OnNoMatchMode = "error"       // refuse to run
+	NoMatchPrompt      OnNoMatchMode = "prompt"      // ask for a profile when interactive, otherwise behave like default or error
+)
+
+// stackTarget is everything a stack can be matched on.
+type stackTarget struct {
+	Name    string
+	Account string // from the stack environment in the cloud assembly, empty when unknown
+	Region  string
+	Action  string            // cdk action the profile is for, selects a rule's per-action profile
+	Context map[string]string // cdk context values, see contextValues
+}
+
+// Resolution records how a profile was chosen for a single stack.
+type Resolution struct {
+	Stack      string
+	Account    string
+	Region     string
+	Action     string
+	Context    map[string]string
+	Winner     *Profile
+	Candidates []Profile
+	Reason     string
+	Prompt     bool // no rule matched and the user is asked for a profile
+}
+
+// Found reports whether a rule matched.
+func (r Resolution) Found() bool {
+	return r.Winner != nil
+}
+
+// resolveTarget matches the stack against every rule and picks a winner according to c.Resolution.
+func (c *Config) resolveTarget(target stackTarget) (Resolution, error) {
+	stackArg := target.Name
+	res := Resolution{Stack: stackArg, Account: target.Account, Region: target.Region, Action: target.Action, Context: target.Context}
+	for i := range c.Profiles {
+		if c.Profiles[i].matchesTarget(target) {
+			res.Candidates = append(res.Candidates, c.Profiles[i])
+		}
+	}
+
+	if len(res.Candidates) == 0 && stackArg == "" && c.AppProfile != "" && lookupAction(target.Action).stackless() {
+		res.Winner = &Profile{Profile: c.AppProfile}
+		res.Reason = "command without a stack name, using appProfile"
+		return res, nil
+	}
+	if len(res.Candidates) == 0 {
+		c.inferProfile(&res)
+		if res.Found() {
+			return res, nil
+		}
+		return res, c.onNoMatch(&res)
+	}
+
+	mode := c.Resolution
+	if mode == "" {
+		mode = ResolveLongest
+	}
+
+	best := 0
+	switch mode {
+	case ResolveFirst:
+		res.Reason = "first matching rule"
+	case ResolveLongest:
+		for i, candidate := range res.Candidates {
+			if candidate.moreSpecific(res.Candidates[best]) {
+				best = i
+			}
+		}
+		res.Reason = specificityReason(res.Candidates, best)
+	case ResolvePriority, ResolvePrompt:
+		for i, candidate := range res.Candidates {
+			current := res.Candidates[best]
+			if candidate.Priority > current.Priority ||
+				(candidate.Priority == current.Priority && candidate.moreSpecific(current)) {
+				best = i
+			}
+		}
+		res.Reason = priorityReason(res.Candidates, best)
+		if mode == ResolvePrompt {
+			if top := topPriority(res.Candidates); !sameProfile(top, target.Action) {
+				if !c.interactive() {
+					return res, fmt.Errorf("stack %s matches conflicting rules: %s", stackArg, describeRules(top))
+				}
+				res.Prompt = true
+				res.Reason = "matching rules disagree, asking for a profile"
+				return res, nil
+			}
+		}
+	case ResolveError:
+		if !sameProfile(res.Candidates, target.Action) {
+			return res, fmt.Errorf("stack %s matches conflicting rules: %s", stackArg, describeRules(res.Candidates))
+		}
+		res.Reason = "only matching profile"
+	default:
+		return res, fmt.Errorf("unknown resolution %q", mode)
+	}
+
+	if len(res.Candidates) == 1 {
+		res.Reason = "only matching rule"
+	}
+	res.Winner = &res.Candidates[best]
+	return res, nil
+}
+
+// inferProfile falls back to the single AWS profile whose sso_account_id is the stack's account.
+func (c *Config) inferProfile(res *Resolution) {
+	res.Reason = "no rule matched"
+	if !c.InferProfiles || res.Account == "" {
+		return
+	}
+
+	aws := c.awsProfiles()
+	if aws == nil {
+		return
+	}
+
+	switch names := aws.profilesForAccount(res.Account); len(names) {
+	case 0:
+		res.Reason = fmt.Sprintf("no rule matched and no aws profile has sso_account_id %s", res.Account)
+	case 1:
+		res.Winner = &Profile{Account: res.Account, Profile: names[0]}
+		res.Reason = fmt.Sprintf("inferred from sso_account_id in %s", aws.Path)
+	default:
+		res.Reason = fmt.Sprintf("no rule matched and account %s has several aws profiles: %s", res.Account, strings.Join(names, ", "))
+	}
+}
+
+// specificityReasons name what decided between two rules, from the strongest tie-breaker to the weakest.
+var specificityReasons = []string{"", "most specific account and region", "most context values", "longest match", "equally specific, listed first"}
+
+// specificityReason names the weakest tie-breaker the winner needed against any other candidate,
+// that is the one that settled it against the runner-up.
+func specificityReason(candidates []Profile, best int) string {
+	level := 0
+	for i, other := range candidates {
+		if i != best {
+			level = max(level, candidates[best].tieBreak(other))
+		}
+	}
+	return specificityReasons[level]
+}
+
+// priorityReason is specificityReason for resolution priority, where specificity only settles equal priorities.
+func priorityReason(candidates []Profile, best int) string {
+	tied := []Profile{candidates[best]}
+	for i, candidate := range candidates {
+		if i != best && candidate.Priority == candidates[best].Priority {
+			tied = append(tied, candidate)
+		}
+	}
+	if len(tied) == 1 {
+		return "highest priority"
+	}
+	return "highest priority, then " + specificityReason(tied, 0)
+}
+
+// tieBreak is the index in specificityReasons of what puts p ahead of other, see moreSpecific.
+func (p Profile) tieBreak(other Profile) int {
+	switch {
+	case p.environmentSelectors() != other.environmentSelectors():
+		return 1
+	case len(p.Context) != len(other.Context):
+		return 2
+	case len(p.Match) != len(other.Match):
+		return 3
+	default:
+		return 4
+	}
+}
+
+// topPriority returns the candidates sharing the highest priority.
+func topPriority(candidates []Profile) []Profile {
+	var top []Profile
+	for _, candidate := range candidates {
+		switch {
+		case len(top) == 0 || candidate.Priority == top[0].Priority:
+			top = append(top, candidate)
+		case candidate.Priority > top[0].Priority:
+			top = []Profile{candidate}
+		}
+	}
+	return top
+}
+
+// sameProfile reports whether the rules all give action the same profile.
+func sameProfile(rules []Profile, action string) bool {
+	for _, rule := range rules[1:] {
+		if rule.profileFor(action) != rules[0].profileFor(action) {
+			return false
+		}
+	}
+	return true
+}
+
+// noMatchMode is the configured onNoMatch, defaulting to default when a defaultProfile is set.
+func (c *Config) noMatchMode() OnNoMatchMode {
+	switch {
+	case c.OnNoMatch != "":
+		return c.OnNoMatch
+	case c.DefaultProfile != "":
+		return NoMatchDefault
+	default:
+		return NoMatchPassthrough
+	}
+}
+
+// onNoMatch applies the onNoMatch setting to a stack that no rule or inference matched.
+func (c *Config) onNoMatch(res *Resolution) error {
+	mode := c.noMatchMode()
+	if mode == NoMatchPrompt {
+		switch {
+		case c.interactive():
+			res.Prompt = true
+			res.Reason += ", asking for a profile"
+			return nil
+		case c.DefaultProfile != "":
+			mode = NoMatchDefault
+		default:
+			mode = NoMatchError
+		}
+	}
+
+	switch mode {
+	case NoMatchDefault:
+		res.Winner = &Profile{Profile: c.DefaultProfile}
+		res.Reason += ", using defaultProfile"
+	case NoMatchError:
+		if res.Stack == "" {
+			// cdk synth and cdk list are profiled too, point at the setting that covers them
+			return fmt.Errorf("%s: %s and onNoMatch is %s, set appProfile for commands such as cdk synth or cdk list", stackLabel(res.Stack), res.Reason, c.noMatchMode())
+		}
+		return fmt.Errorf("%s: %s and onNoMatch is %s", stackLabel(res.Stack), res.Reason, c.noMatchMode())
+	}
+	return nil
+}
+
+// stackLabel names a stack in messages, commands without stack arguments have an empty name.
+func stackLabel(stack string) string {
+	if stack == "" {
+		return "command without a stack name"
+	}
+	if strings.HasPrefix(stack, "aws://") {
+		return "environment " + stack
+	}
+	return "stack " + stack
+}
+
+// profileFor is the profile the rule gives action, its per-action override or else Profile.
+// Aliases such as ls for list share the override.
+func (p *Profile) profileFor(action string) string {
+	if profile, ok := p.Actions[action]; ok && profile != "" {
+		return profile
+	}
+	name := lookupAction(action).Name
+	for _, key := range sortedKeys(p.Actions) {
+		if lookupAction(key).Name == name && p.Actions[key] != "" {
+			return p.Actions[key]
+		}
+	}
+	return p.Profile
+}
+
+// profiles lists every profile the rule can hand out, Profile first.
+func (p *Profile) profiles() []string {
+	profiles := []string{p.Profile}
+	for _, action := range sortedKeys(p.Actions) {
+		profiles = append(profiles, p.Actions[action])
+	}
+	return profiles
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// moreSpecific reports whether p beats other on specificity, a rule with more of account and region
+// beats one with fewer, then the rule with more context values wins.
+func (p Profile) moreSpecific(other Profile) bool {
+	if p.environmentSelectors() != other.environmentSelectors() {
+		return p.environmentSelectors() > other.environmentSelectors()
+	}
+	if len(p.Context) != len(other.Context) {
+		return len(p.Context) > len(other.Context)
+	}
+	return len(p.Match) > len(other.Match)
+}
+
+// describe renders the rule for diagnostics.
+func (p Profile) describe() string {
+	var selectors []string
+	if p.Match != "" || p.environmentSelectors() == 0 && len(p.Context) == 0 {
+		matchType := p.MatchType
+		if matchType == "" {
+			matchType = MatchSubstring
+		}
+		selectors = append(selectors, fmt.Sprintf("%s %q", matchType, p.Match))
+	}
+	if p.Account != "" {
+		selectors = append(selectors, fmt.Sprintf("account %q", p.Account))
+	}
+	if p.Region != "" {
+		selectors = append(selectors, fmt.Sprintf("region %q", p.Region))
+	}
+	for _, key := range sortedKeys(p.Context) {
+		selectors = append(selectors, fmt.Sprintf("context %s=%q", key, p.Context[key]))
+	}
+	desc := fmt.Sprintf("%s -> %s", strings.Join(selectors, " and "), p.Profile)
+	if len(p.Actions) > 0 {
+		actions := make([]string, 0, len(p.Actions))
+		for _, action := range sortedKeys(p.Actions) {
+			actions = append(actions, fmt.Sprintf("%s: %s", action, p.Actions[action]))
+		}
+		desc += fmt.Sprintf(" (%s)", strings.Join(actions, ", "))
+	}
+	if p.Priority != 0 {
+		desc += fmt.Sprintf(" (priority %d)", p.Priority)
+	}
+	return desc
+}
+
+func describeRules(rules []Profile) string {
+	descs := make([]string, len(rules))
+	for i, rule := range rules {
+		descs[i] = rule.describe()
+	}
+	return strings.Join(descs, "; ")
+}
+
+// profileGroup is a set of stacks that resolved to the same profile, an empty Profile means no rule matched.
+type profileGroup struct {
+	Profile string
+	Stacks  []string
+}
+
+// groupStacks resolves every stack and groups them by profile in order of first appearance.
+func (c *Config) groupStacks(targets []stackTarget) ([]profileGroup, error) {
+	var groups []profileGroup
+	index := map[string]int{}
+	for _, target := range targets {
+		stack := target.Name
+		profile, _, err := c.findTarget(target)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := index[profile]
+		if !ok {
+			i = len(groups)
+			index[profile] = i
+			groups = append(groups, profileGroup{Profile: profile})
+		}
+		groups[i].Stacks = append(groups[i].Stacks, stack)
+	}
+	return groups, nil
+}
+
+// commandGroups resolves every stack selected by cmd and groups them by profile.
+func (c *Config) commandGroups(cmd *CDKCommand) ([]profileGroup, error) {
+	return c.groupStacks(cmd.stackTargets())
+}
+
+// applyProfiles sets the profile on cmd, or splits it into groups when its stacks disagree and splitting is enabled.
+func (c *Config) applyProfiles(cmd *CDKCommand) error {
+	groups, err := c.commandGroups(cmd)
+	if err != nil {
+		return err
+	}
+
+	if len(groups) == 0 {
+		// an app without stacks, cdk reports it
+		return nil
+	}
+	if len(groups) > 1 {
+		// one cdk bootstrap cannot use a profile per environment, so environments are always split
+		if !cmd.Split && !c.Split && cmd.action.Stacks != StackArgsEnvironments {
+			return fmt.Errorf("stacks resolve to different profiles: %s (use %s or split: true to run cdk once per profile)", describeGroups(groups), splitFlag)
+		}
+		cmd.Groups = groups
+		return nil
+	}
+
+	if groups[0].Profile != "" {
+		cmd.SetProfile(groups[0].Profile)
+	}
+	return nil
+}
+
+func describeGroups(groups []profileGroup) string {
+	descs := make([]string, len(groups))
+	for i, group := range groups {
+		profile := group.Profile
+		if profile == "" {
+			profile = "(no profile)"
+		}
+		descs[i] = fmt.Sprintf("%s -> %s", strings.Join(group.Stacks, ", "), profile)
+	}
+	return strings.Join(descs, "; ")
+}
@@ -0,0 +1,613 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type resolveSuite struct {
+	suite.Suite
+}
+
+func (s *resolveSuite) rules() []Profile {
+	return []Profile{
+		{Match: "Api", Profile: "api_admin", Priority: 10},
+		{Match: "ProdApi", Profile: "prod_admin"},
+		{Match: "Prod", Profile: "prod_readonly", Priority: 5},
+	}
+}
+
+func (s *resolveSuite) TestResolutionModes() {
+	tests := []struct {
+		name   string
+		mode   ResolutionMode
+		want   string
+		reason string
+	}{
+		{name: "default is longest", mode: "", want: "prod_admin", reason: "longest match"},
+		{name: "longest", mode: ResolveLongest, want: "prod_admin", reason: "longest match"},
+		{name: "first", mode: ResolveFirst, want: "api_admin", reason: "first matching rule"},
+		{name: "priority", mode: ResolvePriority, want: "api_admin", reason: "highest priority"},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			config := &Config{Profiles: s.rules(), Resolution: tt.mode}
+			res, err := config.resolveTarget(stackTarget{Name: "ProdApiStack"})
+			s.Require().NoError(err)
+			s.Require().True(res.Found())
+			s.Equal(tt.want, res.Winner.Profile)
+			s.Equal(tt.reason, res.Reason)
+			s.Len(res.Candidates, 3)
+		})
+	}
+}
+
+func (s *resolveSuite) TestPriorityTieFallsBackToLongest() {
+	config := &Config{
+		Resolution: ResolvePriority,
+		Profiles: []Profile{
+			{Match: "Prod", Profile: "prod_readonly"},
+			{Match: "ProdApi", Profile: "prod_admin"},
+		},
+	}
+
+	profile, ok, err := config.findTarget(stackTarget{Name: "ProdApiStack"})
+	s.Require().NoError(err)
+	s.True(ok)
+	s.Equal("prod_admin", profile)
+}
+
+func (s *resolveSuite) TestErrorMode() {
+	config := &Config{Profiles: s.rules(), Resolution: ResolveError}
+
+	_, ok, err := config.findTarget(stackTarget{Name: "ProdApiStack"})
+	s.False(ok)
+	s.Require().Error(err)
+	s.Contains(err.Error(), "stack ProdApiStack matches conflicting rules")
+	s.Contains(err.Error(), `substring "Api" -> api_admin (priority 10)`)
+	s.Contains(err.Error(), `substring "ProdApi" -> prod_admin`)
+
+	s.Run("single match is fine", func() {
+		profile, ok, err := config.findTarget(stackTarget{Name: "ProdWorkerStack"})
+		s.Require().NoError(err)
+		s.True(ok)
+		s.Equal("prod_readonly", profile)
+	})
+
+	s.Run("agreeing rules are fine", func() {
+		config := &Config{
+			Resolution: ResolveError,
+			Profiles: []Profile{
+				{Match: "Prod", Profile: "prod_admin"},
+				{Match: "Api", Profile: "prod_admin"},
+			},
+		}
+		res, err := config.resolveTarget(stackTarget{Name: "ProdApiStack"})
+		s.Require().NoError(err)
+		s.Equal("prod_admin", res.Winner.Profile)
+	})
+}
+
+func (s *resolveSuite) TestNoMatch() {
+	config := &Config{Profiles: s.rules()}
+	res, err := config.resolveTarget(stackTarget{Name: "StagingStack"})
+	s.Require().NoError(err)
+	s.False(res.Found())
+	s.Equal("no rule matched", res.Reason)
+}
+
+func (s *resolveSuite) TestOnNoMatch() {
+	originalTerminal := stdinIsTerminal
+	defer func() { stdinIsTerminal = originalTerminal }()
+
+	tests := []struct {
+		name     string
+		config   Config
+		terminal bool
+		want     string
+		prompt   bool
+		err      string
+	}{
+		{name: "passthrough by default", want: ""},
+		{name: "defaultProfile implies default", config: Config{DefaultProfile: "sandbox"}, want: "sandbox"},
+		{name: "explicit passthrough", config: Config{DefaultProfile: "sandbox", OnNoMatch: NoMatchPassthrough}, want: ""},
+		{name: "error", config: Config{OnNoMatch: NoMatchError}, err: "stack StagingStack: no rule matched and onNoMatch is error"},
+		{name: "prompt on a terminal", config: Config{OnNoMatch: NoMatchPrompt}, terminal: true, prompt: true},
+		{name: "prompt falls back to default", config: Config{DefaultProfile: "sandbox", OnNoMatch: NoMatchPrompt}, want: "sandbox"},
+		{name: "prompt without default fails", config: Config{OnNoMatch: NoMatchPrompt}, err: "no rule matched and onNoMatch is prompt"},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			stdinIsTerminal = func() bool { return tt.terminal }
+			config := tt.config
+			config.Profiles = s.rules()
+
+			res, err := config.resolveTarget(stackTarget{Name: "StagingStack"})
+			if tt.err != "" {
+				s.Require().Error(err)
+				s.Contains(err.Error(), tt.err)
+				return
+			}
+			s.Require().NoError(err)
+			s.Equal(tt.prompt, res.Prompt)
+			if tt.want == "" {
+				s.False(res.Found())
+				return
+			}
+			s.Equal(tt.want, res.Winner.Profile)
+			s.Equal("no rule matched, using defaultProfile", res.Reason)
+		})
+	}
+
+	s.Run("matching rules are unaffected", func() {
+		config := &Config{Profiles: s.rules(), OnNoMatch: NoMatchError}
+		profile, ok, err := config.findTarget(stackTarget{Name: "ProdApi"})
+		s.Require().NoError(err)
+		s.True(ok)
+		s.Equal("prod_admin", profile)
+	})
+
+	s.Run("stackless commands", func() {
+		config := &Config{OnNoMatch: NoMatchError}
+		_, _, err := config.findTarget(stackTarget{Name: ""})
+		s.Require().Error(err)
+		s.EqualError(err, "command without a stack name: no rule matched and onNoMatch is error, set appProfile for commands such as cdk synth or cdk list")
+	})
+}
+
+func (s *resolveSuite) TestPromptProfile() {
+	originalTerminal, originalStdin, originalOutput := stdinIsTerminal, stdin, promptOutput
+	defer func() { stdinIsTerminal, stdin, promptOutput = originalTerminal, originalStdin, originalOutput }()
+	stdinIsTerminal = func() bool { return true }
+	promptOutput = io.Discard
+	writeAWSConfig(s.T(), testAWSConfig)
+
+	stdin = strings.NewReader("\nprod_typo\ndev_admin\nprod_admin\n")
+	config := &Config{Profiles: s.rules(), OnNoMatch: NoMatchPrompt}
+	groups, err := config.groupStacks([]stackTarget{{Name: "StagingStack"}, {Name: "ProdApi"}, {Name: "Sandbox"}})
+	s.Require().NoError(err)
+	s.Equal([]profileGroup{{Profile: "dev_admin", Stacks: []string{"StagingStack"}}, {Profile: "prod_admin", Stacks: []string{"ProdApi", "Sandbox"}}}, groups)
+
+	stdin = strings.NewReader("")
+	_, _, err = config.findTarget(stackTarget{Name: "StagingStack"})
+	s.Require().Error(err)
+	s.Contains(err.Error(), "no profile chosen for stack StagingStack")
+}
+
+func (s *resolveSuite) TestOnNoMatchSettings() {
+	config := &Config{OnNoMatch: NoMatchDefault}
+	s.NoError(config.compileSettings())
+	s.EqualError(config.checkCombined(), "onNoMatch default needs a defaultProfile")
+
+	config = &Config{OnNoMatch: "ask"}
+	s.ErrorContains(config.compileSettings(), `unknown onNoMatch "ask"`)
+
+	writeAWSConfig(s.T(), testAWSConfig)
+	config = &Config{DefaultProfile: "dev_admn"}
+	s.ErrorContains(config.validateProfiles(), `defaultProfile: unknown aws profile "dev_admn", did you mean dev_admin?`)
+}
+
+func (s *resolveSuite) TestAppProfile() {
+	config := &Config{Profiles: s.rules(), AppProfile: "dev_admin", DefaultProfile: "sandbox", OnNoMatch: NoMatchError}
+
+	res, err := config.resolveTarget(stackTarget{Action: "synth"})
+	s.Require().NoError(err)
+	s.Equal("dev_admin", res.Winner.Profile)
+	s.Equal("command without a stack name, using appProfile", res.Reason)
+
+	res, err = config.resolveTarget(stackTarget{Action: "context"})
+	s.Require().NoError(err)
+	s.Equal("dev_admin", res.Winner.Profile)
+
+	cmd := parseArgs([]string{"synth", "-c", "stage=dev"})
+	s.Require().NoError(config.applyProfiles(cmd))
+	s.Equal("dev_admin", cmd.Profile)
+
+	s.Run("stacks are unaffected", func() {
+		_, err := config.resolveTarget(stackTarget{Name: "StagingStack"})
+		s.ErrorContains(err, "stack StagingStack: no rule matched")
+	})
+
+	s.Run("commands on stacks resolve every stack instead", func() {
+		dir := s.T().TempDir()
+		s.Require().NoError(os.MkdirAll(filepath.Join(dir, "assembly-Staging"), 0700))
+		s.Require().NoError(os.WriteFile(filepath.Join(dir, manifestFile), []byte(testManifest), 0600))
+		s.Require().NoError(os.WriteFile(filepath.Join(dir, "assembly-Staging", manifestFile), []byte(testNestedManifest), 0600))
+
+		for _, args := range [][]string{{"deploy", "--all"}, {"deploy"}, {"destroy"}, {"watch"}} {
+			passthrough := &Config{AppProfile: "dev_admin"}
+			cmd := parseArgs(append(args, "-o", dir))
+			cmd.useAction(lookupAction(cmd.Action))
+			s.Require().NoError(cmd.selectStacks("cdk", false))
+			s.Equal([]string{"DevApi", "ProdApi", "ProdWorker", "Staging/Api"}, cmd.Targets)
+			s.Require().NoError(passthrough.applyProfiles(cmd))
+			s.Empty(cmd.Profile, "%v must not run every stack with appProfile", args)
+
+			cmd = parseArgs(append(args, "-o", dir))
+			cmd.useAction(lookupAction(cmd.Action))
+			s.Require().NoError(cmd.selectStacks("cdk", false))
+			s.ErrorContains(config.applyProfiles(cmd), "stacks resolve to different profiles: DevApi, Staging/Api -> api_admin; ProdApi -> prod_admin; ProdWorker -> prod_readonly")
+		}
+	})
+
+	s.Run("checked against the aws profiles", func() {
+		writeAWSConfig(s.T(), testAWSConfig)
+		config := &Config{AppProfile: "prod_admn"}
+		s.ErrorContains(config.validateProfiles(), `appProfile: unknown aws profile "prod_admn", did you mean prod_admin?`)
+	})
+}
+
+func (s *resolveSuite) TestActionProfiles() {
+	prod := Profile{
+		Match:   "Prod",
+		Profile: "prod_admin",
+		Actions: map[string]string{"diff": "prod_readonly", "destroy": "prod_breakglass"},
+	}
+	config := &Config{Profiles: []Profile{prod, {Match: "Dev", Profile: "dev_admin"}}}
+
+	for action, want := range map[string]string{"diff": "prod_readonly", "deploy": "prod_admin", "destroy": "prod_breakglass"} {
+		cmd := parseArgs([]string{action, "ProdApi"})
+		s.Require().NoError(config.applyProfiles(cmd))
+		s.Equal(want, cmd.Profile, action)
+	}
+
+	cmd := parseArgs([]string{"diff", "DevApi"})
+	s.Require().NoError(config.applyProfiles(cmd))
+	s.Equal("dev_admin", cmd.Profile, "rules without actions use profile")
+
+	s.Equal("prod_readonly", (&Profile{Profile: "prod_admin", Actions: map[string]string{"list": "prod_readonly"}}).profileFor("ls"), "aliases share the override")
+
+	s.Equal(`substring "Prod" -> prod_admin (destroy: prod_breakglass, diff: prod_readonly)`, prod.describe())
+	s.Equal([]string{"prod_admin", "prod_breakglass", "prod_readonly"}, prod.profiles())
+
+	s.Run("conflicts are per action", func() {
+		config := &Config{Resolution: ResolveError, Profiles: []Profile{
+			{Match: "Prod", Profile: "prod_admin", Actions: map[string]string{"diff": "prod_readonly"}},
+			{Match: "Api", Profile: "prod_admin"},
+		}}
+		_, err := config.resolveTarget(stackTarget{Name: "ProdApi", Action: "deploy"})
+		s.NoError(err)
+		_, err = config.resolveTarget(stackTarget{Name: "ProdApi", Action: "diff"})
+		s.ErrorContains(err, "matches conflicting rules")
+	})
+
+	s.Run("action profiles are validated", func() {
+		writeAWSConfig(s.T(), testAWSConfig)
+		config := &Config{Profiles: []Profile{{Match: "Prod", Profile: "prod_admin", Actions: map[string]string{"diff": "prod_readnly"}}}}
+		s.ErrorContains(config.validateProfiles(), `profile rule 1 (match "Prod"): unknown aws profile "prod_readnly", did you mean prod_readonly?`)
+	})
+}
+
+func (s *resolveSuite) TestLoadConfig_Resolution() {
+	dir := s.T().TempDir()
+	s.T().Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "missing"))
+
+	s.Run("valid", func() {
+		configPath := filepath.Join(dir, "valid.yml")
+		s.Require().NoError(os.WriteFile(configPath, []byte("resolution: priority\nprofiles:\n  - match: Prod\n    profile: prod_admin\n    priority: 3\n"), 0600))
+		s.T().Setenv("CDKPW_CONFIG", configPath)
+
+		config, err := loadConfig()
+		s.Require().NoError(err)
+		s.Equal(ResolvePriority, config.Resolution)
+		s.Equal(3, config.Profiles[0].Priority)
+	})
+
+	s.Run("unknown mode", func() {
+		configPath := filepath.Join(dir, "invalid.yml")
+		s.Require().NoError(os.WriteFile(configPath, []byte("resolution: newest\n"), 0600))
+		s.T().Setenv("CDKPW_CONFIG", configPath)
+
+		_, err := loadConfig()
+		s.Require().Error(err)
+		s.Contains(err.Error(), `unknown resolution "newest"`)
+	})
+}
+
+func (s *resolveSuite) TestApplyProfiles() {
+	config := &Config{
+		Profiles: []Profile{
+			{Match: "Prod", Profile: "prod_admin"},
+			{Match: "Dev", Profile: "dev_admin"},
+		},
+	}
+
+	s.Run("stacks agree", func() {
+		cmd := parseArgs([]string{"deploy", "ProdApi", "ProdWorker"})
+		s.Require().NoError(config.applyProfiles(cmd))
+		s.Equal("prod_admin", cmd.Profile)
+		s.Equal([]string{"deploy", "ProdApi", "ProdWorker", "--profile", "prod_admin"}, cmd.RawArgs)
+		s.Empty(cmd.Groups)
+	})
+
+	s.Run("no stacks", func() {
+		cmd := parseArgs([]string{"deploy"})
+		s.Require().NoError(config.applyProfiles(cmd))
+		s.False(cmd.IsProfiled())
+	})
+
+	s.Run("stacks disagree", func() {
+		cmd := parseArgs([]string{"deploy", "DevApi", "ProdApi", "DevWorker"})
+		err := config.applyProfiles(cmd)
+		s.Require().Error(err)
+		s.Contains(err.Error(), "stacks resolve to different profiles: DevApi, DevWorker -> dev_admin; ProdApi -> prod_admin")
+		s.False(cmd.IsProfiled())
+	})
+
+	s.Run("unmatched stack does not borrow a profile", func() {
+		err := config.applyProfiles(parseArgs([]string{"deploy", "ProdApi", "SharedVpc"}))
+		s.Require().Error(err)
+		s.Contains(err.Error(), "SharedVpc -> (no profile)")
+	})
+
+	s.Run("split flag groups stacks", func() {
+		cmd := parseArgs([]string{"deploy", "DevApi", "--cdkpw-split", "ProdApi", "DevWorker"})
+		s.Require().NoError(config.applyProfiles(cmd))
+		s.False(cmd.IsProfiled())
+		s.Equal([]profileGroup{
+			{Profile: "dev_admin", Stacks: []string{"DevApi", "DevWorker"}},
+			{Profile: "prod_admin", Stacks: []string{"ProdApi"}},
+		}, cmd.Groups)
+	})
+
+	s.Run("split from config", func() {
+		config := &Config{Profiles: config.Profiles, Split: true}
+		cmd := parseArgs([]string{"deploy", "DevApi", "ProdApi"})
+		s.Require().NoError(config.applyProfiles(cmd))
+		s.Len(cmd.Groups, 2)
+	})
+}
+
+func (s *resolveSuite) TestAccountRules() {
+	config := &Config{
+		Profiles: []Profile{
+			{Match: "Api", Profile: "api_admin"},
+			{Account: "111111111111", Profile: "prod_admin"},
+			{Account: "111111111111", Match: "Audit", Profile: "prod_audit"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		target stackTarget
+		want   string
+	}{
+		{name: "account beats name", target: stackTarget{Name: "RenamedApi", Account: "111111111111"}, want: "prod_admin"},
+		{name: "account and name", target: stackTarget{Name: "AuditStack", Account: "111111111111"}, want: "prod_audit"},
+		{name: "other account", target: stackTarget{Name: "RenamedApi", Account: "222222222222"}, want: "api_admin"},
+		{name: "unknown account", target: stackTarget{Name: "AuditStack"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			profile, _, err := config.findTarget(tt.target)
+			s.Require().NoError(err)
+			s.Equal(tt.want, profile)
+		})
+	}
+
+	res, err := config.resolveTarget(stackTarget{Name: "RenamedApi", Account: "111111111111"})
+	s.Require().NoError(err)
+	s.Equal("most specific account and region", res.Reason, "the account won, not the match length")
+
+	s.Equal(`account "111111111111" -> prod_admin`, config.Profiles[1].describe())
+	s.Equal(`substring "Audit" and account "111111111111" -> prod_audit`, config.Profiles[2].describe())
+	s.True(config.needsEnvironment())
+	s.False((&Config{Profiles: []Profile{{Match: "Api"}}}).needsEnvironment())
+}
+
+func (s *resolveSuite) TestResolutionReasons() {
+	tests := []struct {
+		name   string
+		config Config
+		target stackTarget
+		want   string
+	}{
+		{
+			name:   "longest match",
+			config: Config{Profiles: []Profile{{Match: "Prod", Profile: "a"}, {Match: "ProdApi", Profile: "b"}}},
+			target: stackTarget{Name: "ProdApi"},
+			want:   "longest match",
+		},
+		{
+			name:   "listed first",
+			config: Config{Profiles: []Profile{{Match: "Prod", Profile: "a"}, {Match: "Prod", MatchType: MatchPrefix, Profile: "b"}}},
+			target: stackTarget{Name: "ProdApi"},
+			want:   "equally specific, listed first",
+		},
+		{
+			name:   "context",
+			config: Config{Profiles: []Profile{{Match: "ProdApi", Profile: "a"}, {Match: "Api", Context: map[string]string{"stage": "prod"}, Profile: "b"}}},
+			target: stackTarget{Name: "ProdApi", Context: map[string]string{"stage": "prod"}},
+			want:   "most context values",
+		},
+		{
+			name:   "priority alone",
+			config: Config{Resolution: ResolvePriority, Profiles: []Profile{{Match: "ProdApi", Profile: "a"}, {Match: "Api", Profile: "b", Priority: 1}}},
+			target: stackTarget{Name: "ProdApi"},
+			want:   "highest priority",
+		},
+		{
+			name: "priority then specificity",
+			config: Config{Resolution: ResolvePriority, Profiles: []Profile{
+				{Match: "Prod", Profile: "a", Priority: 1},
+				{Account: "111111111111", Profile: "b", Priority: 1},
+				{Match: "ProdApi", Profile: "c"},
+			}},
+			target: stackTarget{Name: "ProdApi", Account: "111111111111"},
+			want:   "highest priority, then most specific account and region",
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			res, err := tt.config.resolveTarget(tt.target)
+			s.Require().NoError(err)
+			s.Equal(tt.want, res.Reason)
+		})
+	}
+}
+
+func (s *resolveSuite) TestEnvironmentRules() {
+	config := &Config{
+		Profiles: []Profile{
+			{Account: "111111111111", Profile: "prod_admin"},
+			{Account: "111111111111", Region: "us-east-1", Profile: "prod_us"},
+			{Region: "ap-southeast-2", Profile: "apac_admin"},
+			{Match: "222222222222", Profile: "dev_admin"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []profileGroup
+	}{
+		{
+			name: "account",
+			args: []string{"bootstrap", "aws://111111111111/eu-west-1"},
+			want: []profileGroup{{Profile: "prod_admin", Stacks: []string{"aws://111111111111/eu-west-1"}}},
+		},
+		{
+			name: "account and region beat account",
+			args: []string{"bootstrap", "aws://111111111111/us-east-1"},
+			want: []profileGroup{{Profile: "prod_us", Stacks: []string{"aws://111111111111/us-east-1"}}},
+		},
+		{
+			name: "region of a wildcard account",
+			args: []string{"gc", "aws://*/ap-southeast-2", "--unstable=gc"},
+			want: []profileGroup{{Profile: "apac_admin", Stacks: []string{"aws://*/ap-southeast-2"}}},
+		},
+		{
+			name: "name rules still apply",
+			args: []string{"bootstrap", "aws://222222222222/eu-west-1"},
+			want: []profileGroup{{Profile: "dev_admin", Stacks: []string{"aws://222222222222/eu-west-1"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			cmd := parseArgs(tt.args)
+			cmd.useAction(lookupAction(cmd.Action))
+			groups, err := config.commandGroups(cmd)
+			s.Require().NoError(err)
+			s.Equal(tt.want, groups)
+		})
+	}
+
+	s.Run("one profile per environment", func() {
+		cmd := parseArgs([]string{"bootstrap", "aws://111111111111/eu-west-1", "aws://222222222222/eu-west-1", "aws://111111111111/eu-central-1"})
+		cmd.useAction(lookupAction(cmd.Action))
+		s.Require().NoError(config.applyProfiles(cmd))
+		s.Empty(cmd.Profile)
+		s.Equal([]profileGroup{
+			{Profile: "prod_admin", Stacks: []string{"aws://111111111111/eu-west-1", "aws://111111111111/eu-central-1"}},
+			{Profile: "dev_admin", Stacks: []string{"aws://222222222222/eu-west-1"}},
+		}, cmd.Groups)
+		s.Equal([]string{"bootstrap", "aws://222222222222/eu-west-1", "--profile", "dev_admin"}, cmd.groupArgs(cmd.Groups[1]))
+	})
+
+	s.Run("bootstrap flags", func() {
+		cmd := parseArgs([]string{"bootstrap", "--trust", "222222222222", "--cloudformation-execution-policies", "arn:aws:iam::aws:policy/AdministratorAccess",
+			"aws://111111111111/eu-west-1", "aws://222222222222/eu-west-1", "-b", "bucket", "-cpb", "boundary"})
+		cmd.useAction(lookupAction(cmd.Action))
+		s.Require().NoError(cmd.selectStacks("cdk", config.needsEnvironment()))
+		s.Require().NoError(config.applyProfiles(cmd))
+		s.Empty(cmd.Context)
+		s.Equal([]string{"bootstrap", "aws://111111111111/eu-west-1",
+			"--trust", "222222222222", "--cloudformation-execution-policies", "arn:aws:iam::aws:policy/AdministratorAccess", "-b", "bucket", "-cpb", "boundary",
+			"--profile", "prod_admin"}, cmd.groupArgs(cmd.Groups[0]))
+	})
+
+	s.Run("boolean bootstrap flags", func() {
+		cmd := parseArgs([]string{"bootstrap", "--public-access-block-configuration", "aws://111111111111/eu-west-1", "--termination-protection"})
+		cmd.useAction(lookupAction(cmd.Action))
+		s.Require().NoError(cmd.selectStacks("cdk", config.needsEnvironment()))
+		s.Require().NoError(config.applyProfiles(cmd))
+		s.Equal("prod_admin", cmd.Profile)
+	})
+
+	s.Run("no stack listing outside a cdk app", func() {
+		original := execCommand
+		defer func() { execCommand = original }()
+		execCommand = func(string, ...string) *exec.Cmd {
+			s.Fail("cdk list must not run for environments")
+			return exec.Command("false")
+		}
+		cmd := parseArgs([]string{"bootstrap", "aws://111111111111/eu-west-1", "-o", s.T().TempDir()})
+		cmd.useAction(lookupAction(cmd.Action))
+		s.Require().NoError(cmd.selectStacks("cdk", true))
+		s.Nil(cmd.assembly)
+	})
+
+	s.Run("environments of the app", func() {
+		dir := s.T().TempDir()
+		s.Require().NoError(os.WriteFile(filepath.Join(dir, manifestFile), []byte(testManifest), 0600))
+		s.Require().NoError(os.MkdirAll(filepath.Join(dir, "assembly-Staging"), 0700))
+		s.Require().NoError(os.WriteFile(filepath.Join(dir, "assembly-Staging", manifestFile), []byte(testNestedManifest), 0600))
+		cmd := parseArgs([]string{"bootstrap", "-o", dir})
+		cmd.useAction(lookupAction(cmd.Action))
+		s.Require().NoError(cmd.selectStacks("cdk", config.needsEnvironment()))
+		s.Require().NoError(config.applyProfiles(cmd))
+		s.Equal([]profileGroup{
+			{Profile: "dev_admin", Stacks: []string{"aws://222222222222/eu-west-1"}},
+			{Profile: "prod_admin", Stacks: []string{"aws://111111111111/eu-west-1"}},
+			{Stacks: []string{"aws://333333333333/eu-west-1"}},
+		}, cmd.Groups)
+	})
+
+	s.Run("positionals must be environments", func() {
+		cmd := parseArgs([]string{"bootstrap", "--unknown-flag", "222222222222", "aws://111111111111/eu-west-1"})
+		cmd.useAction(lookupAction(cmd.Action))
+		s.EqualError(cmd.selectStacks("cdk", config.needsEnvironment()), `cdk bootstrap takes aws://<account>/<region> environments, got "222222222222"`)
+	})
+
+	s.Run("unmatched environment", func() {
+		config := &Config{OnNoMatch: NoMatchError}
+		cmd := parseArgs([]string{"bootstrap", "aws://333333333333/eu-west-1"})
+		cmd.useAction(lookupAction(cmd.Action))
+		s.EqualError(config.applyProfiles(cmd), "environment aws://333333333333/eu-west-1: no rule matched and onNoMatch is error")
+	})
+
+	s.Equal(`region "ap-southeast-2" -> apac_admin`, config.Profiles[2].describe())
+	s.True((&Config{Profiles: []Profile{{Region: "eu-west-1"}}}).needsEnvironment())
+}
+
+func (s *resolveSuite) TestInferProfiles() {
+	writeAWSConfig(s.T(), testAWSConfig)
+	config := &Config{InferProfiles: true}
+	s.True(config.needsEnvironment())
+
+	res, err := config.resolveTarget(stackTarget{Name: "DevApi", Account: "222222222222"})
+	s.Require().NoError(err)
+	s.Require().True(res.Found())
+	s.Equal("dev_admin", res.Winner.Profile)
+	s.Contains(res.Reason, "inferred from sso_account_id")
+
+	res, err = config.resolveTarget(stackTarget{Name: "ProdApi", Account: "111111111111"})
+	s.Require().NoError(err)
+	s.False(res.Found())
+	s.Contains(res.Reason, "several aws profiles: prod_admin, prod_readonly")
+
+	res, err = config.resolveTarget(stackTarget{Name: "QaApi", Account: "333333333333"})
+	s.Require().NoError(err)
+	s.False(res.Found())
+
+	s.Run("disabled", func() {
+		res, err := (&Config{}).resolveTarget(stackTarget{Name: "DevApi", Account: "222222222222"})
+		s.Require().NoError(err)
+		s.False(res.Found())
+	})
+}
+
+func TestResolveSuite(t *testing.T) {
+	suite.Run(t, new(resolveSuite))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+const schemaID = "https://raw.githubusercontent.com/phelian/cdkpw/main/cdkpw.schema.json"
+
+// jsonSchema is the subset of JSON Schema draft 07 needed to describe the config.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	ID                   string                 `json:"$id,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Enum                 []any                  `json:"enum,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"`
+}
+
+// schemaEnums lists the allowed values of the enum types in the config.
+var schemaEnums = map[reflect.Type][]any{
+	reflect.TypeOf(Verbose(0)):         {SILENT, INFO, DEBUG},
+	reflect.TypeOf(MatchType("")):      {MatchSubstring, MatchPrefix, MatchSuffix, MatchGlob, MatchRegex},
+	reflect.TypeOf(ResolutionMode("")): {ResolveLongest, ResolveFirst, ResolvePriority, ResolveError, ResolvePrompt},
+	reflect.TypeOf(SSOLoginMode("")):   {SSOLoginAuto, SSOLoginPrint, SSOLoginOff},
+	reflect.TypeOf(OnNoMatchMode("")):  {NoMatchPassthrough, NoMatchDefault, NoMatchError, NoMatchPrompt},
+}
+
+// configSchema derives the JSON Schema of .cdkpw.yml from the Config struct.
+func configSchema() *jsonSchema {
+	schema := typeSchema(reflect.TypeOf(Config{}))
+	schema.Schema = "http://json-schema.org/draft-07/schema#"
+	schema.ID = schemaID
+	schema.Title = "cdkpw config"
+	schema.Description = "Profile rules for cdkpw, the profile-aware wrapper for the AWS CDK CLI"
+	return schema
+}
+
+func typeSchema(t reflect.Type) *jsonSchema {
+	schema := &jsonSchema{}
+	if values, ok := schemaEnums[t]; ok {
+		schema.Enum = values
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		schema.Type = "string"
+	case reflect.Int:
+		schema.Type = "integer"
+	case reflect.Bool:
+		schema.Type = "boolean"
+	case reflect.Slice:
+		schema.Type = "array"
+		schema.Items = typeSchema(t.Elem())
+	case reflect.Map:
+		schema.Type = "object"
+		schema.AdditionalProperties = typeSchema(t.Elem())
+	case reflect.Struct:
+		schema.Type = "object"
+		schema.AdditionalProperties = false
+		schema.Properties = map[string]*jsonSchema{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := yamlName(field)
+			if name == "" || !field.IsExported() {
+				continue
+			}
+			property := typeSchema(field.Type)
+			property.Description = field.Tag.Get("doc")
+			schema.Properties[name] = property
+		}
+	default:
+		panic(fmt.Sprintf("no JSON Schema type for %s", t))
+	}
+	return schema
+}
+
+// runConfigSchema prints the JSON Schema of the config file.
+func runConfigSchema(out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(configSchema())
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// schemaFile is the published schema, regenerate it with `just schema`.
+const schemaFile = "../../cdkpw.schema.json"
+
+type schemaSuite struct {
+	suite.Suite
+}
+
+func (s *schemaSuite) TestPublishedSchemaIsCurrent() {
+	published, err := os.ReadFile(schemaFile)
+	s.Require().NoError(err)
+
+	var generated bytes.Buffer
+	s.Require().NoError(runConfig([]string{"schema"}, &generated))
+	s.Equal(string(published), generated.String(), "cdkpw.schema.json is out of date, run `just schema`")
+}
+
+func (s *schemaSuite) TestEveryFieldIsDescribed() {
+	for _, t := range []reflect.Type{reflect.TypeOf(Config{}), reflect.TypeOf(Profile{})} {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() || yamlName(field) == "" {
+				continue
+			}
+			s.NotEmpty(field.Tag.Get("doc"), "%s.%s needs a doc tag", t.Name(), field.Name)
+
+			if field.Type.PkgPath() != "" && field.Type.Kind() != reflect.Struct {
+				s.Contains(schemaEnums, field.Type, "%s.%s has no enum values in schemaEnums", t.Name(), field.Name)
+			}
+		}
+	}
+}
+
+func (s *schemaSuite) TestEnumsAcceptedByConfig() {
+	for _, mode := range schemaEnums[reflect.TypeOf(ResolutionMode(""))] {
+		s.NoError((&Config{Resolution: mode.(ResolutionMode)}).compileSettings())
+	}
+	for _, mode := range schemaEnums[reflect.TypeOf(SSOLoginMode(""))] {
+		s.NoError((&Config{SSOLogin: mode.(SSOLoginMode)}).compileSettings())
+	}
+	for _, matchType := range schemaEnums[reflect.TypeOf(MatchType(""))] {
+		s.NoError((&Profile{Match: "Prod", MatchType: matchType.(MatchType)}).compile())
+	}
+}
+
+func (s *schemaSuite) TestVerboseEnum() {
+	schema := configSchema()
+	verbose := schema.Properties["verbose"]
+	s.Equal("integer", verbose.Type)
+	s.Equal([]any{SILENT, INFO, DEBUG}, verbose.Enum)
+	s.Equal(false, schema.Properties["profiles"].Items.AdditionalProperties)
+}
+
+func TestSchemaSuite(t *testing.T) {
+	suite.Run(t, new(schemaSuite))
+}
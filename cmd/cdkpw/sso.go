@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SSOLoginMode controls what happens when an SSO profile has no valid token.
+type SSOLoginMode string
+
+const (
+	SSOLoginAuto  SSOLoginMode = "auto"  // default, run `aws sso login` when interactive, otherwise print it
+	SSOLoginPrint SSOLoginMode = "print" // only print the login command
+	SSOLoginOff   SSOLoginMode = "off"   // never check the token cache
+)
+
+var (
+	timeNow         = time.Now
+	stdinIsTerminal = func() bool {
+		info, err := os.Stdin.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0
+	}
+)
+
+type ssoToken struct {
+	AccessToken string    `json:"accessToken"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// ssoProfile returns the profile holding the SSO settings profile signs in with and what the AWS CLI
+// hashes to name its token cache file, the sso_session name or, for legacy profiles, the sso_start_url.
+// A role profile is followed through its source_profile. An empty key means not an SSO profile.
+func (a *awsConfig) ssoProfile(profile string) (string, string) {
+	seen := map[string]bool{}
+	for profile != "" && !seen[profile] {
+		seen[profile] = true
+		settings := a.Profiles[profile]
+		if session := settings["sso_session"]; session != "" {
+			return profile, session
+		}
+		if startURL := settings["sso_start_url"]; startURL != "" {
+			return profile, startURL
+		}
+		profile = settings["source_profile"]
+	}
+	return "", ""
+}
+
+// ssoTokenValid looks for an unexpired token for key in ~/.aws/sso/cache.
+func ssoTokenValid(key string) bool {
+	home, err := getUserHomeDir()
+	if err != nil {
+		return false
+	}
+
+	// The AWS CLI names cache files after the SHA-1 of the key
+	sum := sha1.Sum([]byte(key))
+	data, err := os.ReadFile(filepath.Join(home, ".aws", "sso", "cache", hex.EncodeToString(sum[:])+".json"))
+	if err != nil {
+		return false
+	}
+
+	var token ssoToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return false
+	}
+	return token.AccessToken != "" && token.ExpiresAt.After(timeNow())
+}
+
+// ensureSSOLogin makes sure profile has a valid SSO session before cdk uses it.
+func (c *Config) ensureSSOLogin(profile string) error {
+	if c.SSOLogin == SSOLoginOff {
+		return nil
+	}
+
+	aws := c.awsProfiles()
+	if aws == nil {
+		return nil
+	}
+	// aws sso login needs the profile with the SSO settings, not a role profile sourcing it
+	login, key := aws.ssoProfile(profile)
+	if key == "" || ssoTokenValid(key) {
+		return nil
+	}
+
+	if c.SSOLogin == SSOLoginPrint || !stdinIsTerminal() {
+		fmt.Printf("cdkpw: SSO session for profile %s is missing or expired, run: aws sso login --profile %s\n", profile, login)
+		return nil
+	}
+
+	if c.Verbose >= INFO {
+		fmt.Printf("cdkpw: SSO session for profile %s is missing or expired, logging in\n", profile)
+	}
+	cmd := execCommand("aws", "sso", "login", "--profile", login)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("aws sso login --profile %s failed: %w", login, err)
+	}
+	return nil
+}
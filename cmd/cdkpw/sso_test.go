@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ssoSuite struct {
+	suite.Suite
+	home    string
+	called  [][]string
+	restore func()
+}
+
+var testNow = time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func (s *ssoSuite) SetupTest() {
+	s.home = s.T().TempDir()
+	s.called = nil
+	writeAWSConfig(s.T(), testAWSConfig)
+
+	originalHome, originalNow, originalTerminal, originalExec := getUserHomeDir, timeNow, stdinIsTerminal, execCommand
+	s.restore = func() {
+		getUserHomeDir, timeNow, stdinIsTerminal, execCommand = originalHome, originalNow, originalTerminal, originalExec
+	}
+	getUserHomeDir = func() (string, error) { return s.home, nil }
+	timeNow = func() time.Time { return testNow }
+	stdinIsTerminal = func() bool { return true }
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		s.called = append(s.called, append([]string{command}, args...))
+		return exec.Command("true")
+	}
+}
+
+func (s *ssoSuite) TearDownTest() {
+	s.restore()
+}
+
+func (s *ssoSuite) writeToken(key, expiresAt string) {
+	dir := filepath.Join(s.home, ".aws", "sso", "cache")
+	s.Require().NoError(os.MkdirAll(dir, 0700))
+	sum := sha1.Sum([]byte(key))
+	token := `{"accessToken": "token", "expiresAt": "` + expiresAt + `", "region": "eu-west-1"}`
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, hex.EncodeToString(sum[:])+".json"), []byte(token), 0600))
+}
+
+const testRoleProfiles = `
+[profile deployer]
+role_arn = arn:aws:iam::111111111111:role/Deployer
+source_profile = prod_readonly
+
+[profile chained]
+role_arn = arn:aws:iam::111111111111:role/Chained
+source_profile = deployer
+
+[profile loop]
+role_arn = arn:aws:iam::111111111111:role/Loop
+source_profile = loop
+`
+
+func (s *ssoSuite) TestSSOProfile() {
+	writeAWSConfig(s.T(), testAWSConfig+testRoleProfiles)
+	aws := (&Config{}).awsProfiles()
+	s.Require().NotNil(aws)
+
+	tests := []struct {
+		profile string
+		login   string
+		key     string
+	}{
+		{profile: "prod_admin", login: "prod_admin", key: "corp"},
+		{profile: "dev_admin", login: "dev_admin", key: "https://corp.awsapps.com/start"},
+		{profile: "deployer", login: "prod_readonly", key: "corp"},
+		{profile: "chained", login: "prod_readonly", key: "corp"},
+		{profile: "loop"},
+		{profile: "default"},
+	}
+	for _, tt := range tests {
+		s.Run(tt.profile, func() {
+			login, key := aws.ssoProfile(tt.profile)
+			s.Equal(tt.login, login)
+			s.Equal(tt.key, key)
+		})
+	}
+}
+
+func (s *ssoSuite) TestRoleProfileLogsInWithSource() {
+	writeAWSConfig(s.T(), testAWSConfig+testRoleProfiles)
+	s.writeToken("corp", "2026-05-01T11:00:00Z")
+	s.NoError((&Config{}).ensureSSOLogin("deployer"))
+	s.Equal([][]string{{"aws", "sso", "login", "--profile", "prod_readonly"}}, s.called)
+}
+
+func (s *ssoSuite) TestValidTokenSkipsLogin() {
+	s.writeToken("corp", "2026-05-01T13:00:00Z")
+	s.NoError((&Config{}).ensureSSOLogin("prod_admin"))
+	s.Empty(s.called)
+}
+
+func (s *ssoSuite) TestExpiredTokenLogsIn() {
+	s.writeToken("https://corp.awsapps.com/start", "2026-05-01T11:00:00Z")
+	s.NoError((&Config{}).ensureSSOLogin("dev_admin"))
+	s.Equal([][]string{{"aws", "sso", "login", "--profile", "dev_admin"}}, s.called)
+}
+
+func (s *ssoSuite) TestMissingTokenLogsIn() {
+	s.NoError((&Config{SSOLogin: SSOLoginAuto}).ensureSSOLogin("prod_admin"))
+	s.Len(s.called, 1)
+}
+
+func (s *ssoSuite) TestLoginFailure() {
+	execCommand = func(string, ...string) *exec.Cmd { return exec.Command("false") }
+	err := (&Config{}).ensureSSOLogin("prod_admin")
+	s.Require().Error(err)
+	s.Contains(err.Error(), "aws sso login --profile prod_admin failed")
+}
+
+func (s *ssoSuite) TestNonInteractivePrints() {
+	stdinIsTerminal = func() bool { return false }
+	s.NoError((&Config{}).ensureSSOLogin("prod_admin"))
+	s.Empty(s.called)
+
+	stdinIsTerminal = func() bool { return true }
+	s.NoError((&Config{SSOLogin: SSOLoginPrint}).ensureSSOLogin("prod_admin"))
+	s.Empty(s.called)
+}
+
+func (s *ssoSuite) TestSkipped() {
+	s.NoError((&Config{SSOLogin: SSOLoginOff}).ensureSSOLogin("prod_admin"))
+	s.NoError((&Config{}).ensureSSOLogin("default"))
+	s.NoError((&Config{}).ensureSSOLogin("not_in_config"))
+	s.Empty(s.called)
+}
+
+func (s *ssoSuite) TestCommandProfiles() {
+	s.Empty((&CDKCommand{}).profiles())
+	s.Equal([]string{"prod_admin"}, (&CDKCommand{Profile: "prod_admin"}).profiles())
+	s.Equal([]string{"dev_admin", "prod_admin"}, (&CDKCommand{Groups: []profileGroup{
+		{Profile: "dev_admin"}, {Stacks: []string{"Shared"}}, {Profile: "prod_admin"},
+	}}).profiles())
+}
+
+func TestSSOSuite(t *testing.T) {
+	suite.Run(t, new(ssoSuite))
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configError is a problem at a position in a config file.
+type configError struct {
+	Path   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e configError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Path, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.Path, e.Line, e.Column, e.Msg)
+}
+
+// configErrors collects every problem of a file so they can be fixed in one go.
+type configErrors []configError
+
+func (e configErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// decodeConfig strictly decodes a YAML, JSON or TOML config, or the cdkpw block of cdk.json: unknown keys, bad patterns, incomplete or
+// duplicate rules and out of range values are all reported with their line and column.
+func decodeConfig(path string, data []byte) (Config, map[string]bool, error) {
+	var config Config
+	root, err := parseConfigNode(path, data)
+	if err != nil {
+		return config, nil, err
+	}
+	if len(root.Content) == 0 {
+		return config, map[string]bool{}, nil
+	}
+
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return config, nil, configErrors{{path, doc.Line, doc.Column, "config must be a mapping of settings"}}
+	}
+	if errs := checkKnownFields(path, doc, reflect.TypeOf(config)); len(errs) > 0 {
+		return config, nil, errs
+	}
+
+	// Decode what was checked, for TOML and cdk.json that is not the file content
+	if data, err = yaml.Marshal(doc); err != nil {
+		return config, nil, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return config, nil, fmt.Errorf("invalid config in %s: %w", path, err)
+	}
+
+	keys := map[string]bool{}
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		keys[doc.Content[i].Value] = true
+		if doc.Content[i].Value == "profiles" {
+			for j, item := range doc.Content[i+1].Content {
+				if j < len(config.Profiles) {
+					config.Profiles[j].line, config.Profiles[j].column = item.Line, item.Column
+					config.Profiles[j].actionAt = actionKeyPositions(item)
+				}
+			}
+		}
+	}
+
+	if errs := config.validate(path, doc); len(errs) > 0 {
+		return config, nil, errs
+	}
+	return config, keys, nil
+}
+
+// checkKnownFields walks node alongside t and reports keys that have no matching yaml field.
+func checkKnownFields(path string, node *yaml.Node, t reflect.Type) configErrors {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var errs configErrors
+	switch {
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			if name := yamlName(t.Field(i)); name != "" && t.Field(i).IsExported() {
+				fields[name] = t.Field(i).Type
+			}
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				errs = append(errs, configError{path, key.Line, key.Column, unknownFieldMsg(key.Value, fields)})
+				continue
+			}
+			errs = append(errs, checkKnownFields(path, node.Content[i+1], fieldType)...)
+		}
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Map:
+		for i := 1; i < len(node.Content); i += 2 {
+			errs = append(errs, checkKnownFields(path, node.Content[i], t.Elem())...)
+		}
+	case node.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		for _, item := range node.Content {
+			errs = append(errs, checkKnownFields(path, item, t.Elem())...)
+		}
+	}
+	return errs
+}
+
+func unknownFieldMsg(key string, fields map[string]reflect.Type) string {
+	best, bestDistance := "", len(key)/2+1
+	for name := range fields {
+		if distance := levenshtein(strings.ToLower(key), strings.ToLower(name)); distance < bestDistance ||
+			(distance == bestDistance && name < best) {
+			best, bestDistance = name, distance
+		}
+	}
+	if best != "" {
+		return fmt.Sprintf("unknown key %q, did you mean %q?", key, best)
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("unknown key %q, expected one of %s", key, strings.Join(names, ", "))
+}
+
+// validate checks the values of a decoded file, doc is used to point at the offending setting.
+func (c *Config) validate(path string, doc *yaml.Node) configErrors {
+	var errs configErrors
+	at := func(key string) (int, int) {
+		for i := 0; i+1 < len(doc.Content); i += 2 {
+			if doc.Content[i].Value == key {
+				return doc.Content[i+1].Line, doc.Content[i+1].Column
+			}
+		}
+		return doc.Line, doc.Column
+	}
+
+	if c.Verbose < SILENT || c.Verbose > DEBUG {
+		line, column := at("verbose")
+		errs = append(errs, configError{path, line, column, fmt.Sprintf("verbose must be 0 (silent), 1 (info) or 2 (debug), got %d", c.Verbose)})
+	}
+	var setting settingError
+	if err := c.compileSettings(); errors.As(err, &setting) {
+		line, column := at(setting.key)
+		errs = append(errs, configError{path, line, column, setting.msg})
+	}
+
+	seen := map[string]Profile{}
+	for i := range c.Profiles {
+		rule := &c.Profiles[i]
+		fail := func(msg string) {
+			errs = append(errs, configError{path, rule.line, rule.column, fmt.Sprintf("profile rule %d: %s", i+1, msg)})
+		}
+
+		if !rule.hasSelector() {
+			fail("match must not be empty")
+		}
+		if rule.Profile == "" {
+			fail("profile must not be empty")
+		}
+		for _, action := range sortedKeys(rule.Actions) {
+			if rule.Actions[action] == "" {
+				fail(fmt.Sprintf("profile for action %s must not be empty", action))
+			}
+		}
+		if err := rule.compile(); err != nil {
+			fail(err.Error())
+		}
+
+		key := rule.selectorKey()
+		if first, ok := seen[key]; ok && rule.hasSelector() {
+			fail(fmt.Sprintf("duplicate of the rule at line %d", first.line))
+		} else {
+			seen[key] = *rule
+		}
+	}
+	return errs
+}
+
+// actionKeyPositions maps the keys of the actions of a profile rule to their position, nil without actions.
+func actionKeyPositions(rule *yaml.Node) map[string][2]int {
+	var positions map[string][2]int
+	for i := 0; i+1 < len(rule.Content); i += 2 {
+		if rule.Content[i].Value != "actions" {
+			continue
+		}
+		actions := rule.Content[i+1]
+		positions = map[string][2]int{}
+		for j := 0; j+1 < len(actions.Content); j += 2 {
+			positions[actions.Content[j].Value] = [2]int{actions.Content[j].Line, actions.Content[j].Column}
+		}
+	}
+	return positions
+}
+
+// hasSelector reports whether the rule restricts which stacks it applies to.
+func (p *Profile) hasSelector() bool {
+	return p.Match != "" || p.environmentSelectors() > 0 || len(p.Context) > 0
+}
+
+// environmentSelectors counts the account and region the rule is restricted to.
+func (p *Profile) environmentSelectors() int {
+	count := 0
+	for _, selector := range []string{p.Account, p.Region} {
+		if selector != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// selectorKey identifies rules that select exactly the same stacks.
+func (p *Profile) selectorKey() string {
+	matchType := p.MatchType
+	if matchType == "" {
+		matchType = MatchSubstring
+	}
+	key := []string{string(matchType), p.Match, p.Account, p.Region}
+	for _, name := range sortedKeys(p.Context) {
+		key = append(key, name+"="+p.Context[name])
+	}
+	return strings.Join(key, "\x00")
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type validateSuite struct {
+	suite.Suite
+	dir string
+}
+
+func (s *validateSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.T().Setenv("AWS_CONFIG_FILE", filepath.Join(s.dir, "missing"))
+}
+
+func (s *validateSuite) decode(content string) error {
+	_, _, err := decodeConfig("cdkpw.yml", []byte(content))
+	return err
+}
+
+func (s *validateSuite) TestValid() {
+	config, keys, err := decodeConfig("cdkpw.yml", []byte(`
+verbose: 2
+resolution: priority
+profiles:
+  - match: Prod
+    profile: prod_admin
+  - account: "111111111111"
+    profile: prod_admin
+  - match: Prod
+    matchType: prefix
+    profile: prod_readonly
+`))
+	s.Require().NoError(err)
+	s.Equal(map[string]bool{"verbose": true, "resolution": true, "profiles": true}, keys)
+	s.Equal(7, config.Profiles[1].line)
+	s.Equal(5, config.Profiles[1].column)
+}
+
+func (s *validateSuite) TestEmpty() {
+	config, keys, err := decodeConfig("cdkpw.yml", []byte("# nothing yet\n"))
+	s.Require().NoError(err)
+	s.Empty(keys)
+	s.Empty(config.Profiles)
+}
+
+func (s *validateSuite) TestUnknownKeys() {
+	err := s.decode(`
+verbos: 1
+profiles:
+  - match: Prod
+    profle: prod_admin
+  - match: Dev
+    profile: dev_admin
+    colour: blue
+`)
+	s.Require().Error(err)
+	s.Equal(`cdkpw.yml:2:1: unknown key "verbos", did you mean "verbose"?
+cdkpw.yml:5:5: unknown key "profle", did you mean "profile"?
+cdkpw.yml:8:5: unknown key "colour", expected one of account, actions, context, expectAccount, match, matchType, name, priority, profile, region`, err.Error())
+}
+
+func (s *validateSuite) TestInvalidValues() {
+	err := s.decode(`
+verbose: 3
+resolution: newest
+profiles:
+  - match: Prod
+    profile: prod_admin
+  - match: ""
+    profile: dev_admin
+  - match: Api
+  - match: "(Api"
+    matchType: regex
+    profile: api_admin
+  - match: Prod
+    matchType: substring
+    profile: other_admin
+`)
+	s.Require().Error(err)
+	s.Equal(`cdkpw.yml:2:10: verbose must be 0 (silent), 1 (info) or 2 (debug), got 3
+cdkpw.yml:3:13: unknown resolution "newest", expected first, longest, priority, error or prompt
+cdkpw.yml:7:5: profile rule 2: match must not be empty
+cdkpw.yml:9:5: profile rule 3: profile must not be empty
+cdkpw.yml:10:5: profile rule 4: invalid regex "(Api": error parsing regexp: missing closing ): `+"`(Api`"+`
+cdkpw.yml:13:5: profile rule 5: duplicate of the rule at line 5`, err.Error())
+}
+
+func (s *validateSuite) TestEmptyActionProfile() {
+	err := s.decode("profiles:\n  - match: Prod\n    profile: prod_admin\n    actions:\n      diff: \"\"\n")
+	s.Require().Error(err)
+	s.Equal("cdkpw.yml:2:5: profile rule 1: profile for action diff must not be empty", err.Error())
+}
+
+func (s *validateSuite) TestUnknownAction() {
+	path := filepath.Join(s.dir, "cdkpw.yml")
+	s.Require().NoError(os.WriteFile(path, []byte(`
+profiles:
+  - match: Prod
+    profile: prod_admin
+    actions:
+      dif: prod_readonly
+      ls: prod_readonly
+      publish: prod_admin
+      zzzzzz: prod_admin
+`), 0600))
+	s.T().Setenv("CDKPW_CONFIG", path)
+
+	_, err := loadConfig()
+	s.Require().Error(err)
+	s.Contains(err.Error(), path+`:6:7: unknown action "dif", did you mean "diff"?
+`+path+`:8:7: unknown action "publish", expected a cdk command such as deploy or diff
+`+path+`:9:7: unknown action "zzzzzz", expected a cdk command such as deploy or diff`)
+
+	s.Require().NoError(os.WriteFile(path, []byte("profiledActions: [publish]\nprofiles:\n  - match: Prod\n    profile: prod_admin\n    actions:\n      publish: prod_readonly\n"), 0600))
+	_, err = loadConfig()
+	s.Require().NoError(err)
+}
+
+func (s *validateSuite) TestNotAMapping() {
+	err := s.decode("- match: Prod\n")
+	s.Require().Error(err)
+	s.Contains(err.Error(), "cdkpw.yml:1:1: config must be a mapping of settings")
+}
+
+func (s *validateSuite) TestStrictOnLoad() {
+	path := filepath.Join(s.dir, "config.yml")
+	s.Require().NoError(os.WriteFile(path, []byte("profiles:\n  - match: Prod\n    profle: prod_admin\n"), 0600))
+	s.T().Setenv("CDKPW_CONFIG", path)
+
+	_, err := loadConfig()
+	s.Require().Error(err)
+	s.Contains(err.Error(), path+`:3:5: unknown key "profle"`)
+}
+
+func (s *validateSuite) TestValidateCommand() {
+	good := filepath.Join(s.dir, "good.yml")
+	bad := filepath.Join(s.dir, "bad.yml")
+	s.Require().NoError(os.WriteFile(good, []byte("profiles:\n  - match: Prod\n    profile: prod_admin\n"), 0600))
+	s.Require().NoError(os.WriteFile(bad, []byte("profiles:\n  - match: Prod\n"), 0600))
+
+	var out bytes.Buffer
+	s.Require().NoError(runConfig([]string{"validate", good}, &out))
+	s.Equal(good+": ok\n", out.String())
+
+	out.Reset()
+	err := runConfig([]string{"validate", good, bad}, &out)
+	s.Require().Error(err)
+	s.Equal("1 of 2 config files are invalid", err.Error())
+	s.Equal(good+": ok\n"+bad+":2:5: profile rule 1: profile must not be empty\n", out.String())
+
+	out.Reset()
+	s.T().Setenv("CDKPW_CONFIG", good)
+	s.Require().NoError(runConfig([]string{"validate"}, &out))
+	s.Equal(good+": ok\n", out.String())
+}
+
+func TestValidateSuite(t *testing.T) {
+	suite.Run(t, new(validateSuite))
+}
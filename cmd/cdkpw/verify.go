@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// verifyAccounts checks that every stack with a known account is deployed with a profile for that account.
+// Stacks or profiles whose account cannot be determined are not checked. Without a synthesized cloud
+// assembly, as in a fresh CI checkout, the stacks come from `cdk list`.
+func (c *Config) verifyAccounts(cmd *CDKCommand) error {
+	if _, err := cmd.listStacks(c.CdkLocation); err != nil {
+		fmt.Printf("cdkpw: Warning, stack accounts not checked: %v\n", err)
+		return nil
+	}
+
+	var mismatches []string
+	for _, target := range c.verifyTargets(cmd) {
+		profile := cmd.profileFor(target.Name)
+		if target.Account == "" || profile == "" {
+			continue
+		}
+
+		expected, source := c.profileAccount(profile)
+		switch {
+		case expected == "":
+			if c.Verbose >= DEBUG {
+				fmt.Printf("cdkpw: Account of profile %s unknown, not checking stack %s\n", profile, target.Name)
+			}
+		case expected != target.Account:
+			mismatches = append(mismatches, fmt.Sprintf("stack %s targets account %s but profile %s is for account %s (%s)",
+				target.Name, target.Account, profile, expected, source))
+		case c.Verbose >= DEBUG:
+			fmt.Printf("cdkpw: Profile %s matches account %s of stack %s\n", profile, expected, target.Name)
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("account mismatch, refusing to %s: %s", cmd.Action, strings.Join(mismatches, "; "))
+	}
+	return nil
+}
+
+// verifyTargets is cmd.stackTargets, except that a bare `cdk deploy` of a single-stack app or `--all` checks every stack.
+func (c *Config) verifyTargets(cmd *CDKCommand) []stackTarget {
+	if len(cmd.Stacks) > 0 || (len(cmd.assembly) != 1 && !cmd.hasFlag("--all")) {
+		return cmd.stackTargets()
+	}
+
+	targets := make([]stackTarget, len(cmd.assembly))
+	for i, stack := range cmd.assembly {
+		targets[i].Name, targets[i].Action = stack.DisplayName, cmd.Action
+		targets[i].Account, targets[i].Region = parseEnvironment(stack.Environment)
+	}
+	return targets
+}
+
+// profileAccount returns the account a profile is expected to use and where that came from.
+func (c *Config) profileAccount(profile string) (string, string) {
+	for _, rule := range c.Profiles {
+		if rule.ExpectAccount != "" && slices.Contains(rule.profiles(), profile) {
+			return rule.ExpectAccount, "expectAccount"
+		}
+	}
+
+	if aws := c.awsProfiles(); aws != nil {
+		if account := aws.Profiles[profile]["sso_account_id"]; account != "" {
+			return account, "sso_account_id in " + aws.Path
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type verifySuite struct {
+	suite.Suite
+	dir string
+}
+
+func (s *verifySuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.Require().NoError(os.MkdirAll(filepath.Join(s.dir, "assembly-Staging"), 0700))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.dir, manifestFile), []byte(testManifest), 0600))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.dir, "assembly-Staging", manifestFile), []byte(testNestedManifest), 0600))
+	writeAWSConfig(s.T(), testAWSConfig)
+}
+
+func (s *verifySuite) TestVerifyAccounts() {
+	config := &Config{
+		Profiles: []Profile{
+			{Match: "Prod", Profile: "prod_admin"},
+			{Match: "Dev", Profile: "dev_admin"},
+			{Match: "Staging", Profile: "staging_admin", ExpectAccount: "333333333333"},
+			{Match: "Typo", Profile: "dev_admin"},
+			{Match: "Worker", Profile: "worker_admin", Actions: map[string]string{"destroy": "breakglass"}, ExpectAccount: "999999999999"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "profile matches sso_account_id", args: []string{"deploy", "ProdApi"}},
+		{name: "profile matches expectAccount", args: []string{"deploy", "Staging/Api"}},
+		{name: "explicit profile is checked", args: []string{"deploy", "ProdApi", "--profile", "dev_admin"},
+			wantErr: "account mismatch, refusing to deploy: stack ProdApi targets account 111111111111 but profile dev_admin is for account 222222222222"},
+		{name: "split groups are checked", args: []string{"destroy", "ProdApi", "DevApi", "--cdkpw-split"}},
+		{name: "action profile is checked", args: []string{"destroy", "ProdWorker"},
+			wantErr: "stack ProdWorker targets account 111111111111 but profile breakglass is for account 999999999999 (expectAccount)"},
+		{name: "stack not in assembly is skipped", args: []string{"deploy", "TypoStack"}},
+		{name: "profile without account is skipped", args: []string{"deploy", "ProdApi", "--profile", "unknown"}},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			cmd := parseArgs(append(tt.args, "-o", s.dir))
+			if !cmd.IsProfiled() {
+				s.Require().NoError(config.applyProfiles(cmd))
+			}
+			err := config.verifyAccounts(cmd)
+			if tt.wantErr == "" {
+				s.NoError(err)
+				return
+			}
+			s.Require().Error(err)
+			s.Contains(err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func (s *verifySuite) TestVerifyAccounts_ConfigTypo() {
+	config := &Config{
+		Profiles: []Profile{
+			{Match: "ProdApi", Profile: "dev_admin"},
+		},
+	}
+
+	cmd := parseArgs([]string{"deploy", "ProdApi", "-o", s.dir})
+	s.Require().NoError(config.applyProfiles(cmd))
+	err := config.verifyAccounts(cmd)
+	s.Require().Error(err)
+	s.Contains(err.Error(), "(sso_account_id in ")
+}
+
+func (s *verifySuite) TestVerifyAccounts_AllStacks() {
+	config := &Config{}
+	cmd := parseArgs([]string{"deploy", "--all", "--profile", "prod_admin", "-o", s.dir})
+
+	err := config.verifyAccounts(cmd)
+	s.Require().Error(err)
+	s.Contains(err.Error(), "stack DevApi targets account 222222222222")
+	s.NotContains(err.Error(), "stack ProdApi")
+}
+
+func (s *verifySuite) TestVerifyAccounts_NoAssembly() {
+	original := execCommand
+	defer func() { execCommand = original }()
+	config := &Config{CdkLocation: "cdk"}
+
+	s.Run("stacks from cdk list", func() {
+		var called []string
+		execCommand = func(command string, args ...string) *exec.Cmd {
+			called = append([]string{command}, args...)
+			return exec.Command("echo", testCdkListLong)
+		}
+		cmd := parseArgs([]string{"deploy", "ProdApi", "--profile", "dev_admin", "-o", filepath.Join(s.dir, "missing")})
+		err := config.verifyAccounts(cmd)
+		s.Require().Error(err)
+		s.Contains(err.Error(), "stack ProdApi targets account 111111111111 but profile dev_admin is for account 222222222222")
+		s.Equal([]string{"cdk", "list", "--long", "--profile", "dev_admin"}, called)
+	})
+
+	s.Run("cdk list runs with the group profile", func() {
+		var called []string
+		execCommand = func(command string, args ...string) *exec.Cmd {
+			called = append([]string{command}, args...)
+			return exec.Command("echo", testCdkListLong)
+		}
+		cmd := parseArgs([]string{"deploy", "ProdApi", "DevApi", "-o", filepath.Join(s.dir, "missing")})
+		cmd.Groups = []profileGroup{{Profile: "prod_admin", Stacks: []string{"ProdApi"}}, {Profile: "dev_admin", Stacks: []string{"DevApi"}}}
+		s.NoError(config.verifyAccounts(cmd))
+		s.Equal([]string{"cdk", "list", "--long", "--profile", "prod_admin"}, called)
+	})
+
+	s.Run("cdk list fails", func() {
+		execCommand = func(string, ...string) *exec.Cmd { return exec.Command("false") }
+		cmd := parseArgs([]string{"deploy", "ProdApi", "--profile", "dev_admin", "-o", filepath.Join(s.dir, "missing")})
+		s.NoError(config.verifyAccounts(cmd))
+	})
+}
+
+func TestVerifySuite(t *testing.T) {
+	suite.Run(t, new(verifySuite))
+}
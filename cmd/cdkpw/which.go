@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// whichStack explains the profile resolution of one stack.
+type whichStack struct {
+	Stack      string   `json:"stack"`
+	Account    string   `json:"account,omitempty"`
+	Profile    string   `json:"profile,omitempty"`
+	Rule       string   `json:"rule,omitempty"`
+	Reason     string   `json:"reason"`
+	Candidates []string `json:"candidates"`
+	Error      string   `json:"error,omitempty"`
+}
+
+type whichReport struct {
+	Action   string       `json:"action"`
+	Profiled bool         `json:"profiled"` // false when cdkpw leaves the action alone, see profiledActions
+	Stacks   []whichStack `json:"stacks"`
+	Commands [][]string   `json:"commands,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+const whichUsage = "usage: cdkpw which [--json] [--action <cdk action>] [<stack>...] [cdk flags]"
+
+// runWhich implements `cdkpw which [--json] [--action deploy] [<stack>...] [cdk flags]`.
+func runWhich(args []string, out io.Writer) error {
+	asJSON := false
+	action := "deploy"
+	var cdkArgs []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--json":
+			asJSON = true
+		case args[i] == "--action":
+			if i+1 == len(args) {
+				return fmt.Errorf("--action needs a value, %s", whichUsage)
+			}
+			action = args[i+1]
+			i++
+		default:
+			cdkArgs = append(cdkArgs, args[i])
+		}
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	// Without stacks the resolution of stackless commands such as cdk synth is explained
+	cmd := parseArgs(append([]string{action}, cdkArgs...))
+
+	report := config.which(cmd)
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(report)
+	}
+	report.print(out)
+	return nil
+}
+
+// which resolves cmd like a real run would and records every decision.
+func (c *Config) which(cmd *CDKCommand) whichReport {
+	action, profiled := c.profiledAction(cmd.Action)
+	cmd.useAction(action)
+	report := whichReport{Action: cmd.Action, Profiled: profiled}
+	if !profiled {
+		report.Commands = [][]string{append([]string{os.ExpandEnv(c.CdkLocation)}, cmd.RawArgs...)}
+		return report
+	}
+
+	if err := cmd.selectStacks(c.CdkLocation, c.needsEnvironment()); err != nil {
+		report.Error = err.Error()
+		return report
+	}
+
+	for _, target := range cmd.stackTargets() {
+		entry := whichStack{Stack: target.Name, Account: target.Account, Candidates: []string{}}
+		res, err := c.resolveTarget(target)
+		entry.Reason = res.Reason
+		for _, candidate := range res.Candidates {
+			entry.Candidates = append(entry.Candidates, candidate.describe())
+		}
+		switch {
+		case err != nil:
+			entry.Error = err.Error()
+		case res.Found():
+			entry.Profile = res.Winner.profileFor(target.Action)
+			entry.Rule = res.Winner.describe()
+		}
+		report.Stacks = append(report.Stacks, entry)
+	}
+
+	if !cmd.IsProfiled() {
+		quiet := *c
+		quiet.Verbose = SILENT
+		quiet.noPrompt = true
+		if err := quiet.applyProfiles(cmd); err != nil {
+			report.Error = err.Error()
+			return report
+		}
+	}
+
+	cdk := os.ExpandEnv(c.CdkLocation)
+	if len(cmd.Groups) > 1 {
+		for _, group := range cmd.Groups {
+			report.Commands = append(report.Commands, append([]string{cdk}, cmd.groupArgs(group)...))
+		}
+	} else {
+		report.Commands = [][]string{append([]string{cdk}, cmd.RawArgs...)}
+	}
+	return report
+}
+
+func (r whichReport) print(out io.Writer) {
+	if !r.Profiled {
+		fmt.Fprintf(out, "cdk %s is not profiled, cdkpw passes it to cdk untouched\n", r.Action)
+	}
+	for _, stack := range r.Stacks {
+		name := stack.Stack
+		if name == "" {
+			name = "(no stack name)"
+		}
+		if stack.Account != "" {
+			name += fmt.Sprintf(" (account %s)", stack.Account)
+		}
+		fmt.Fprintln(out, name)
+
+		switch {
+		case stack.Error != "":
+			fmt.Fprintf(out, "  error:   %s\n", stack.Error)
+		case stack.Profile != "":
+			fmt.Fprintf(out, "  profile: %s\n", stack.Profile)
+			fmt.Fprintf(out, "  reason:  %s\n", stack.Reason)
+		default:
+			fmt.Fprintf(out, "  profile: none, %s\n", stack.Reason)
+		}
+
+		if len(stack.Candidates) > 0 {
+			fmt.Fprintln(out, "  rules:")
+			for _, candidate := range stack.Candidates {
+				marker := " "
+				if candidate == stack.Rule {
+					marker = "*"
+				}
+				fmt.Fprintf(out, "  %s %s\n", marker, candidate)
+			}
+		}
+	}
+
+	if r.Error != "" {
+		fmt.Fprintf(out, "error: %s\n", r.Error)
+	}
+	for _, command := range r.Commands {
+		fmt.Fprintf(out, "command: %s\n", strings.Join(command, " "))
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type whichSuite struct {
+	suite.Suite
+	dir string
+}
+
+const testWhichConfig = `
+cdkLocation: cdk
+profiles:
+  - match: Prod
+    profile: prod_admin
+  - match: ProdApi
+    profile: prod_readonly
+  - match: Dev
+    profile: dev_admin
+`
+
+func (s *whichSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	configPath := filepath.Join(s.dir, "config.yml")
+	s.Require().NoError(os.WriteFile(configPath, []byte(testWhichConfig), 0600))
+	s.T().Setenv("CDKPW_CONFIG", configPath)
+	writeAWSConfig(s.T(), testAWSConfig+"\n[profile prod_readonly]\n")
+
+	s.Require().NoError(os.MkdirAll(filepath.Join(s.dir, "cdk.out", "assembly-Staging"), 0700))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.dir, "cdk.out", manifestFile), []byte(testManifest), 0600))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.dir, "cdk.out", "assembly-Staging", manifestFile), []byte(testNestedManifest), 0600))
+}
+
+func (s *whichSuite) TestWhichText() {
+	var out bytes.Buffer
+	s.Require().NoError(runWhich([]string{"ProdApiStack"}, &out))
+	s.Equal(`ProdApiStack
+  profile: prod_readonly
+  reason:  longest match
+  rules:
+    substring "Prod" -> prod_admin
+  * substring "ProdApi" -> prod_readonly
+command: cdk deploy ProdApiStack --profile prod_readonly
+`, out.String())
+}
+
+func (s *whichSuite) TestWhichNoMatch() {
+	var out bytes.Buffer
+	s.Require().NoError(runWhich([]string{"--action", "diff", "StagingStack"}, &out))
+	s.Equal(`StagingStack
+  profile: none, no rule matched
+command: cdk diff StagingStack
+`, out.String())
+}
+
+func (s *whichSuite) TestWhichConflict() {
+	var out bytes.Buffer
+	s.Require().NoError(runWhich([]string{"DevApi", "ProdWorker"}, &out))
+	s.Contains(out.String(), "error: stacks resolve to different profiles: DevApi -> dev_admin; ProdWorker -> prod_admin")
+
+	out.Reset()
+	s.Require().NoError(runWhich([]string{"DevApi", "ProdWorker", "--cdkpw-split"}, &out))
+	s.Contains(out.String(), "command: cdk deploy DevApi --profile dev_admin\ncommand: cdk deploy ProdWorker --profile prod_admin\n")
+}
+
+func (s *whichSuite) TestWhichJSON() {
+	var out bytes.Buffer
+	s.Require().NoError(runWhich([]string{"--json", "Prod*", "-o", filepath.Join(s.dir, "cdk.out")}, &out))
+
+	var report whichReport
+	s.Require().NoError(json.Unmarshal(out.Bytes(), &report))
+	s.Require().Len(report.Stacks, 2)
+	s.Equal(whichStack{
+		Stack:      "ProdApi",
+		Account:    "111111111111",
+		Profile:    "prod_readonly",
+		Rule:       `substring "ProdApi" -> prod_readonly`,
+		Reason:     "longest match",
+		Candidates: []string{`substring "Prod" -> prod_admin`, `substring "ProdApi" -> prod_readonly`},
+	}, report.Stacks[0])
+	s.Equal("ProdWorker", report.Stacks[1].Stack)
+	s.True(report.Profiled)
+	s.Contains(out.String(), `"substring \"Prod\" -> prod_admin"`)
+	s.Contains(report.Error, "stacks resolve to different profiles: ProdApi -> prod_readonly; ProdWorker -> prod_admin")
+	s.Empty(report.Commands)
+}
+
+func (s *whichSuite) TestWhichUsage() {
+	err := runWhich([]string{"--json", "--action"}, &bytes.Buffer{})
+	s.Require().Error(err)
+	s.Contains(err.Error(), "usage: cdkpw which")
+}
+
+func (s *whichSuite) TestWhichStackless() {
+	s.T().Setenv("CDKPW_APP_PROFILE", "dev_admin")
+	var out bytes.Buffer
+	s.Require().NoError(runWhich([]string{"--action", "synth"}, &out))
+	s.Equal(`(no stack name)
+  profile: dev_admin
+  reason:  command without a stack name, using appProfile
+command: cdk synth --profile dev_admin
+`, out.String())
+}
+
+func (s *whichSuite) TestWhichNotProfiled() {
+	s.T().Setenv("CDKPW_APP_PROFILE", "dev_admin")
+	configPath := filepath.Join(s.dir, "config.yml")
+	s.Require().NoError(os.WriteFile(configPath, []byte(testWhichConfig+"profiledActions: [-list]\n"), 0600))
+
+	var out bytes.Buffer
+	s.Require().NoError(runWhich([]string{"--action", "ls"}, &out))
+	s.Equal(`cdk ls is not profiled, cdkpw passes it to cdk untouched
+command: cdk ls
+`, out.String())
+
+	out.Reset()
+	s.Require().NoError(runWhich([]string{"--action", "context", "--reset", "3"}, &out))
+	s.Equal(`cdk context is not profiled, cdkpw passes it to cdk untouched
+command: cdk context --reset 3
+`, out.String())
+}
+
+func (s *whichSuite) TestLookupSubcommand() {
+	_, ok := lookupSubcommand([]string{"which", "Stack"})
+	s.True(ok)
+	_, ok = lookupSubcommand([]string{"deploy", "Stack"})
+	s.False(ok)
+	_, ok = lookupSubcommand(nil)
+	s.False(ok)
+}
+
+func TestWhichSuite(t *testing.T) {
+	suite.Run(t, new(whichSuite))
+}